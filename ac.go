@@ -12,16 +12,34 @@ import (
 	"github.com/pointlander/matrix"
 )
 
-// AC is an autocoder
-func AC() {
-	rng := matrix.Rand(1)
+// TrainAC trains an autocoder on the optimizations of one or more sets, calling
+// iteration with the best sample after each step of the optimizer
+func TrainAC(seed uint32, sets [][]Opt, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	tokens := make([][]Tokens, len(sets))
+	for i, opts := range sets {
+		tokens[i] = make([]Tokens, len(opts))
+		for j := range opts {
+			tokens[i][j] = opts[j].Tokens()
+		}
+	}
+	return TrainACTokens(seed, PixelTokens, tokens, iteration)
+}
+
+// TrainACTokens trains an autocoder on the tokens of the optimizations of one or more sets in
+// the given encoding, calling iteration with the best sample after each step of the optimizer
+func TrainACTokens(seed uint32, encoding Encoding, sets [][]Tokens, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	if *FlagGradient {
+		return TrainACGradient(seed, encoding, sets, iteration)
+	}
+	rng := matrix.Rand(seed)
+	cost := NewCost("mse")
+	width := encoding.Width
 
-	sets := Load()
 	done := make(chan bool, 8)
-	process := func(sample *matrix.Sample) {
-		opts := make([][]Opt, *FlagSets)
+	model := func(sample *matrix.Sample) ([][]Tokens, [][]Trace) {
+		opts := make([][]Tokens, len(sets))
 		for i := range opts {
-			opts[i] = GetTrainingData(sets, i, 0)
+			opts[i] = CopyTokens(sets[i])
 		}
 		x1 := sample.Vars[0][0].Sample()
 		y1 := sample.Vars[0][1].Sample()
@@ -52,72 +70,57 @@ func AC() {
 		}
 		for i, opt := range opts {
 			for j := range opt {
-				offset := len(opt[j].Input.Input.I) + len(opt[j].Input.Output.I) + len(opt[j].Output.Input.I)
 				for k := 0; k < params[i].Rows; k++ {
-					offset := offset + k
-					w1Offset := Input * k
-					cc := opt[j].Opt.Data[Input*offset : Input*offset+10]
-					w1CC := params[i].Data[w1Offset : w1Offset+10]
-					maxCC, indexCC := float32(0.0), 0
-					for key, value := range w1CC {
-						if value > maxCC {
-							indexCC, maxCC = key, value
-						}
-					}
-					xx := opt[j].Opt.Data[Input*offset+10 : Input*offset+10+30]
-					w1XX := params[i].Data[w1Offset+10 : w1Offset+10+30]
-					maxXX, indexXX := float32(0.0), 0
-					for key, value := range w1XX {
-						if value > maxXX {
-							indexXX, maxXX = key, value
-						}
-					}
-					yy := opt[j].Opt.Data[Input*offset+10+30 : Input*offset+10+30+30]
-					w1YY := params[i].Data[w1Offset+10+30 : w1Offset+10+30+30]
-					maxYY, indexYY := float32(0.0), 0
-					for key, value := range w1YY {
-						if value > maxYY {
-							indexYY, maxYY = key, value
-						}
-					}
-					cc[indexCC] = 1
-					xx[indexXX] = 1
-					yy[indexYY] = 1
-					opt[j].Opt.Data[Input*offset+10+30+30] = 1
+					row := width * (opt[j].Offset + k)
+					encoding.Fill(opt[j].Opt.Data[row:row+width], params[i].Data[width*k:width*(k+1)])
 				}
 			}
 		}
-		sum := 0.0
-		for _, opt := range opts {
-			total, count := 0.0, 0.0
-			for i := range opt {
-				output := w1.MulT(opt[i].Opt).Add(b1).Sigmoid()
-				out := matrix.SelfAttention(q.MulT(output), k.MulT(output), v.MulT(output))
-				for j := 0; j < out.Rows; j++ {
-					for k := 0; k < out.Cols; k++ {
-						diff := out.Data[j*out.Cols+k] - opt[i].Opt.Data[j*out.Cols+k]
-						total += float64(diff * diff)
-						count++
-					}
+		traces := make([][]Trace, len(opts))
+		for i, opt := range opts {
+			traces[i] = make([]Trace, len(opt))
+			for j := range opt {
+				output := w1.MulT(opt[j].Opt).Add(b1).Sigmoid()
+				traces[i][j] = Trace{
+					Opt:            opt[j],
+					Hidden:         output,
+					Reconstruction: matrix.SelfAttention(q.MulT(output), k.MulT(output), v.MulT(output)),
+					Q:              q,
+					K:              k,
+					V:              v,
 				}
 			}
-			sum += total / count
+		}
+		return opts, traces
+	}
+	process := func(sample *matrix.Sample) {
+		_, traces := model(sample)
+		sum := 0.0
+		for _, trace := range traces {
+			sum += cost(trace)
 		}
 		sample.Cost = sum
 		done <- true
 	}
-	opts := make([][]Opt, *FlagSets)
-	for i := range opts {
-		opts[i] = GetTrainingData(sets, i, 0)
+	solved := func(sample matrix.Sample) bool {
+		_, traces := model(&sample)
+		for _, trace := range traces {
+			for _, t := range trace {
+				if !Reconstructed(t) {
+					return false
+				}
+			}
+		}
+		return true
 	}
 	params := []matrix.Matrix{
-		matrix.NewCoord(8*Input, Input), matrix.NewCoord(8*Input, Input), matrix.NewCoord(8*Input, Input),
-		matrix.NewCoord(Input, 8*Input), matrix.NewCoord(8*Input, 1),
+		matrix.NewCoord(8*width, width), matrix.NewCoord(8*width, width), matrix.NewCoord(8*width, width),
+		matrix.NewCoord(width, 8*width), matrix.NewCoord(8*width, 1),
 	}
-	for _, opt := range opts {
-		params = append(params, matrix.NewCoord(Input, opt[0].TargetSize()))
+	for _, opt := range sets {
+		params = append(params, matrix.NewCoord(width, opt[0].Size))
 	}
-	optimizer := matrix.NewOptimizer(&rng, 9, .1, 5+*FlagSets, func(samples []matrix.Sample, x ...matrix.Matrix) {
+	optimizer := NewOptimizer(&rng, 9, .1, 5+len(sets), func(samples []matrix.Sample, x ...matrix.Matrix) {
 		index, flight, cpus := 0, 0, runtime.NumCPU()
 		for flight < cpus && index < len(samples) {
 			go process(&samples[index])
@@ -139,157 +142,191 @@ func AC() {
 		}
 		fmt.Printf("\n")
 	}, params...)
-	printResult := func(sample matrix.Sample, opt []Opt, m int) {
-		w, h := opt[0].Output.Output.W, opt[0].Output.Output.H
-		type Coord struct {
-			Signal float32
-			Coord  int
-		}
-		type Result struct {
-			Color  byte
-			Signal float32
-			IX     int
-			IY     int
-			X      []Coord
-			Y      []Coord
+	budget := NewBudget(33)
+	var sample matrix.Sample
+	for i := 0; budget.Next(i); i++ {
+		sample = optimizer.Iterate()
+		fmt.Println(i, sample.Cost)
+		if iteration != nil {
+			iteration(i, sample)
 		}
-		grid := make([][]Result, h)
-		for j := range grid {
-			grid[j] = make([]Result, w)
+		if budget.Stop(sample.Cost, solved(sample)) {
+			break
 		}
-		x1 := sample.Vars[m][0].Sample()
-		y1 := sample.Vars[m][1].Sample()
-		z1 := sample.Vars[m][2].Sample()
-		w1 := x1.Add(y1.H(z1))
-		for offset := 0; offset < len(w1.Data); offset += Input {
-			maxColor, color := float32(0.0), 0
-			cc := w1.Data[offset : offset+10]
-			for j := range cc {
-				for cc[j] > maxColor {
-					maxColor, color = cc[j], j
-				}
+	}
+	fmt.Println("stopped", budget.Reason)
+	return sample
+}
+
+// Reconstructed is true if the reconstruction of a trace has the colors of the output of the train pair
+func Reconstructed(trace Trace) bool {
+	out, opt := trace.Reconstruction, trace.Opt
+	for j := opt.Output; j < opt.Output+opt.Outputs; j++ {
+		row := out.Data[j*out.Cols : j*out.Cols+10]
+		maxColor, color := float32(0.0), 0
+		for key, value := range row {
+			if value > maxColor {
+				maxColor, color = value, key
 			}
-			xx := w1.Data[offset+10 : offset+10+w]
-			x := make([]Coord, w)
-			for j, value := range xx {
-				x[j].Coord = j
-				x[j].Signal = value
+		}
+		if color != argmax(opt.Opt.Data[j*opt.Opt.Cols:j*opt.Opt.Cols+10]) {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeAC decodes the w by h target grid of the m-th set of a sample, returning the colors
+// and the softmax probability of the color of each cell
+func DecodeAC(sample matrix.Sample, m, w, h int) ([][]byte, [][]float32) {
+	type Coord struct {
+		Signal float32
+		Coord  int
+	}
+	type Result struct {
+		Color       byte
+		Signal      float32
+		Probability float32
+		IX          int
+		IY          int
+		X           []Coord
+		Y           []Coord
+	}
+	grid := make([][]Result, h)
+	for j := range grid {
+		grid[j] = make([]Result, w)
+	}
+	x1 := sample.Vars[5+m][0].Sample()
+	y1 := sample.Vars[5+m][1].Sample()
+	z1 := sample.Vars[5+m][2].Sample()
+	w1 := x1.Add(y1.H(z1))
+	for offset := 0; offset < len(w1.Data); offset += Input {
+		maxColor, color := float32(0.0), 0
+		cc := w1.Data[offset : offset+10]
+		for j := range cc {
+			for cc[j] > maxColor {
+				maxColor, color = cc[j], j
 			}
-			sort.Slice(x, func(i, j int) bool {
-				return x[i].Signal > x[j].Signal
-			})
-			yy := w1.Data[offset+10+w : offset+10+w+h]
-			y := make([]Coord, h)
-			for j, value := range yy {
-				y[j].Coord = j
-				y[j].Signal = value
+		}
+		xx := w1.Data[offset+10 : offset+10+w]
+		x := make([]Coord, w)
+		for j, value := range xx {
+			x[j].Coord = j
+			x[j].Signal = value
+		}
+		sort.Slice(x, func(i, j int) bool {
+			return x[i].Signal > x[j].Signal
+		})
+		yy := w1.Data[offset+10+w : offset+10+w+h]
+		y := make([]Coord, h)
+		for j, value := range yy {
+			y[j].Coord = j
+			y[j].Signal = value
+		}
+		sort.Slice(y, func(i, j int) bool {
+			return y[i].Signal > y[j].Signal
+		})
+		result := Result{
+			Color:       byte(color),
+			Signal:      maxColor,
+			Probability: Probability(cc, color),
+			IX:          0,
+			IY:          0,
+			X:           x,
+			Y:           y,
+		}
+
+		var apply func(result Result) bool
+		apply = func(result Result) bool {
+			ix := result.IX
+			if ix >= w {
+				ix = w - 1
 			}
-			sort.Slice(y, func(i, j int) bool {
-				return y[i].Signal > y[j].Signal
-			})
-			result := Result{
-				Color:  byte(color),
-				Signal: maxColor,
-				IX:     0,
-				IY:     0,
-				X:      x,
-				Y:      y,
+			iy := result.IY
+			if iy >= h {
+				iy = h - 1
 			}
-
-			var apply func(result Result) bool
-			apply = func(result Result) bool {
-				ix := result.IX
-				if ix >= w {
-					ix = w - 1
-				}
-				iy := result.IY
-				if iy >= h {
-					iy = h - 1
-				}
-				x, y := result.X[ix].Coord, result.Y[iy].Coord
-				if result.Signal > grid[y][x].Signal {
-					if grid[y][x].Signal != 0 {
-						for grid[y][x].IX < w || grid[y][x].IY < h {
-							sx := false
-							if grid[y][x].IX < w {
-								sx = true
-								if apply(grid[y][x]) {
-									break
-								}
-								grid[y][x].IX++
-							}
-							sy := false
-							if grid[y][x].IY < h {
-								sy = true
-								if apply(grid[y][x]) {
-									break
-								}
-								grid[y][x].IY++
+			x, y := result.X[ix].Coord, result.Y[iy].Coord
+			if result.Signal > grid[y][x].Signal {
+				if grid[y][x].Signal != 0 {
+					for grid[y][x].IX < w || grid[y][x].IY < h {
+						sx := false
+						if grid[y][x].IX < w {
+							sx = true
+							if apply(grid[y][x]) {
+								break
 							}
-							if sx && sy {
+							grid[y][x].IX++
+						}
+						sy := false
+						if grid[y][x].IY < h {
+							sy = true
+							if apply(grid[y][x]) {
 								break
 							}
+							grid[y][x].IY++
+						}
+						if sx && sy {
+							break
 						}
 					}
-					grid[y][x] = result
-					return true
 				}
-				return false
+				grid[y][x] = result
+				return true
 			}
-			for result.IX < w || result.IY < h {
-				sx := false
-				if result.IX < w {
-					sx = true
-					if apply(result) {
-						break
-					}
-					result.IX++
-				}
-				sy := false
-				if result.IY < h {
-					sy = true
-					if apply(result) {
-						break
-					}
-					result.IY++
-				}
-				if sx && sy {
+			return false
+		}
+		for result.IX < w || result.IY < h {
+			sx := false
+			if result.IX < w {
+				sx = true
+				if apply(result) {
 					break
 				}
+				result.IX++
 			}
-		}
-		index := 0
-		sum, total := 0.0, 0.0
-		for _, v := range grid {
-			for _, value := range v {
-				color := opt[0].Output.Output.I[index].C
-				if color == value.Color {
-					sum++
-					fmt.Printf("* ")
-				} else {
-					fmt.Printf("%d ", value.Color)
+			sy := false
+			if result.IY < h {
+				sy = true
+				if apply(result) {
+					break
 				}
-				index++
-				total++
+				result.IY++
+			}
+			if sx && sy {
+				break
 			}
-			fmt.Println()
 		}
-		fmt.Println("accuracy", sum/total)
 	}
-	var sample matrix.Sample
-	for i := 0; i < 33; i++ {
-		sample = optimizer.Iterate()
-		fmt.Println(i, sample.Cost)
-		cost := sample.Cost
-		for j, opt := range opts {
-			printResult(sample, opt, 5+j)
-		}
-		if cost < 0 {
-			cost = 0
-			break
-		}
-		if cost < 1e-9 {
-			break
+	colors, probabilities := make([][]byte, h), make([][]float32, h)
+	for j, v := range grid {
+		colors[j], probabilities[j] = make([]byte, w), make([]float32, w)
+		for i, value := range v {
+			colors[j][i], probabilities[j][i] = value.Color, value.Probability
 		}
 	}
+	return colors, probabilities
+}
+
+// AC is an autocoder
+func AC() {
+	sets := Load()
+	opts := make([][]Opt, *FlagSets)
+	for i := range opts {
+		opts[i] = GetTrainingData(sets, i, 0)
+	}
+	TrainAC(1, opts, func(i int, sample matrix.Sample) {
+		for j, opt := range opts {
+			target := opt[0].Output.Output
+			grid, _ := DecodeAC(sample, j, target.W, target.H)
+			for _, v := range grid {
+				for _, value := range v {
+					fmt.Printf("%d ", value)
+				}
+				fmt.Println()
+			}
+			accuracy, exact := sets[j].Test[0].Output.Score(grid)
+			fmt.Println("accuracy", accuracy, "exact", exact)
+		}
+	})
 }
@@ -0,0 +1,53 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autodiff
+
+import (
+	"math"
+)
+
+// Adam is the adam optimizer
+// https://arxiv.org/abs/1412.6980
+type Adam struct {
+	Rate    float64
+	Beta1   float64
+	Beta2   float64
+	Epsilon float64
+	M       [][]float64
+	V       [][]float64
+	T       int
+}
+
+// NewAdam creates a new adam optimizer with a learning rate
+func NewAdam(rate float64) *Adam {
+	return &Adam{
+		Rate:    rate,
+		Beta1:   .9,
+		Beta2:   .999,
+		Epsilon: 1e-8,
+	}
+}
+
+// Step updates the data of the variables in place with their gradients
+func (a *Adam) Step(vars ...*Value) {
+	if a.M == nil {
+		a.M, a.V = make([][]float64, len(vars)), make([][]float64, len(vars))
+		for i, v := range vars {
+			a.M[i], a.V[i] = make([]float64, len(v.D)), make([]float64, len(v.D))
+		}
+	}
+	a.T++
+	b1 := 1 - math.Pow(a.Beta1, float64(a.T))
+	b2 := 1 - math.Pow(a.Beta2, float64(a.T))
+	for i, v := range vars {
+		m, s := a.M[i], a.V[i]
+		for j, d := range v.D {
+			g := float64(d)
+			m[j] = a.Beta1*m[j] + (1-a.Beta1)*g
+			s[j] = a.Beta2*s[j] + (1-a.Beta2)*g*g
+			v.X.Data[j] -= float32(a.Rate * (m[j] / b1) / (math.Sqrt(s[j]/b2) + a.Epsilon))
+		}
+	}
+}
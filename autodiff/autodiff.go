@@ -0,0 +1,354 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package autodiff is reverse mode automatic differentiation of the matrix
+// operations of github.com/pointlander/matrix
+package autodiff
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pointlander/matrix"
+)
+
+// Value is a matrix value in a computation with its gradient
+type Value struct {
+	X        matrix.Matrix
+	D        []float32
+	backward func()
+}
+
+// Tape records the operations of a computation
+type Tape struct {
+	values []*Value
+}
+
+// NewTape creates a new tape
+func NewTape() *Tape {
+	return &Tape{}
+}
+
+func (t *Tape) value(cols, rows int, data []float32, backward func(*Value)) *Value {
+	v := &Value{
+		X: matrix.Matrix{
+			Cols: cols,
+			Rows: rows,
+			Data: data,
+		},
+		D: make([]float32, len(data)),
+	}
+	if backward != nil {
+		v.backward = func() {
+			backward(v)
+		}
+	}
+	t.values = append(t.values, v)
+	return v
+}
+
+// Var creates a variable sharing the data of x, whose gradient is accumulated by Backward
+func (t *Tape) Var(x matrix.Matrix) *Value {
+	return t.value(x.Cols, x.Rows, x.Data, nil)
+}
+
+// Backward computes the gradients of the scalar loss with respect to the values of the tape
+func (t *Tape) Backward(loss *Value) {
+	for i := range loss.D {
+		loss.D[i] = 1
+	}
+	for i := len(t.values) - 1; i >= 0; i-- {
+		if t.values[i].backward != nil {
+			t.values[i].backward()
+		}
+	}
+}
+
+// MulT multiplies m by the transpose of n like matrix.Matrix.MulT, computing the
+// dot products in go so that the gradients are exact
+func (t *Tape) MulT(m, n *Value) *Value {
+	if m.X.Cols != n.X.Cols {
+		panic(fmt.Errorf("%d != %d", m.X.Cols, n.X.Cols))
+	}
+	cols := m.X.Cols
+	data := make([]float32, 0, m.X.Rows*n.X.Rows)
+	for r := 0; r < n.X.Rows; r++ {
+		nn := n.X.Data[r*cols : (r+1)*cols]
+		for c := 0; c < m.X.Rows; c++ {
+			data = append(data, dot(m.X.Data[c*cols:(c+1)*cols], nn))
+		}
+	}
+	return t.value(m.X.Rows, n.X.Rows, data, func(o *Value) {
+		for r := 0; r < n.X.Rows; r++ {
+			nn, dn := n.X.Data[r*cols:(r+1)*cols], n.D[r*cols:(r+1)*cols]
+			for c := 0; c < m.X.Rows; c++ {
+				d := o.D[r*o.X.Cols+c]
+				if d == 0 {
+					continue
+				}
+				mm, dm := m.X.Data[c*cols:(c+1)*cols], m.D[c*cols:(c+1)*cols]
+				for k := range mm {
+					dm[k] += d * nn[k]
+					dn[k] += d * mm[k]
+				}
+			}
+		}
+	})
+}
+
+// Add adds n to m, repeating n if it is smaller like matrix.Matrix.Add
+func (t *Tape) Add(m, n *Value) *Value {
+	o := m.X.Add(n.X)
+	return t.value(o.Cols, o.Rows, o.Data, func(o *Value) {
+		lenn := len(n.D)
+		for i, d := range o.D {
+			m.D[i] += d
+			n.D[i%lenn] += d
+		}
+	})
+}
+
+// H is the hadamard product of m and n
+func (t *Tape) H(m, n *Value) *Value {
+	o := m.X.H(n.X)
+	return t.value(o.Cols, o.Rows, o.Data, func(o *Value) {
+		lenn := len(n.D)
+		for i, d := range o.D {
+			m.D[i] += d * n.X.Data[i%lenn]
+			n.D[i%lenn] += d * m.X.Data[i]
+		}
+	})
+}
+
+// Sigmoid is the sigmoid of m
+func (t *Tape) Sigmoid(m *Value) *Value {
+	o := m.X.Sigmoid()
+	return t.value(o.Cols, o.Rows, o.Data, func(o *Value) {
+		for i, d := range o.D {
+			s := o.X.Data[i]
+			m.D[i] += d * s * (1 - s)
+		}
+	})
+}
+
+// Everett is the everett activation of m, which doubles the columns
+func (t *Tape) Everett(m *Value) *Value {
+	o := m.X.Everett()
+	return t.value(o.Cols, o.Rows, o.Data, func(o *Value) {
+		for i, value := range m.X.Data {
+			if value < 0 {
+				m.D[i] += o.D[2*i]
+			} else if value > 0 {
+				m.D[i] += o.D[2*i+1]
+			}
+		}
+	})
+}
+
+// Concat stacks the rows of n under the rows of m
+func (t *Tape) Concat(m, n *Value) *Value {
+	if m.X.Cols != n.X.Cols {
+		panic(fmt.Errorf("%d != %d", m.X.Cols, n.X.Cols))
+	}
+	data := make([]float32, 0, len(m.X.Data)+len(n.X.Data))
+	data = append(data, m.X.Data...)
+	data = append(data, n.X.Data...)
+	return t.value(m.X.Cols, m.X.Rows+n.X.Rows, data, func(o *Value) {
+		for i := range m.D {
+			m.D[i] += o.D[i]
+		}
+		for i := range n.D {
+			n.D[i] += o.D[len(m.D)+i]
+		}
+	})
+}
+
+// Softmax is the softmax of consecutive segments of the given widths of each row of m
+func (t *Tape) Softmax(m *Value, widths ...int) *Value {
+	data := make([]float32, len(m.X.Data))
+	for r := 0; r < m.X.Rows; r++ {
+		offset := r * m.X.Cols
+		for _, width := range widths {
+			softmax(m.X.Data[offset:offset+width], data[offset:offset+width])
+			offset += width
+		}
+	}
+	return t.value(m.X.Cols, m.X.Rows, data, func(o *Value) {
+		for r := 0; r < m.X.Rows; r++ {
+			offset := r * m.X.Cols
+			for _, width := range widths {
+				y, dy := o.X.Data[offset:offset+width], o.D[offset:offset+width]
+				sum := float32(0)
+				for i := range y {
+					sum += y[i] * dy[i]
+				}
+				for i := range y {
+					m.D[offset+i] += y[i] * (dy[i] - sum)
+				}
+				offset += width
+			}
+		}
+	})
+}
+
+func dot(x, y []float32) float32 {
+	sum := float32(0)
+	for i, value := range x {
+		sum += value * y[i]
+	}
+	return sum
+}
+
+func softmax(values, output []float32) {
+	max := values[0]
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+	sum := float32(0)
+	for i, value := range values {
+		output[i] = float32(math.Exp(float64(value - max)))
+		sum += output[i]
+	}
+	for i := range output {
+		output[i] /= sum
+	}
+}
+
+// attention computes the attention weights of the i-th row of K over the rows of Q
+func attention(Q, K matrix.Matrix, i int, weights []float32) {
+	k := K.Data[i*K.Cols : (i+1)*K.Cols]
+	for j := 0; j < Q.Rows; j++ {
+		weights[j] = dot(k, Q.Data[j*Q.Cols:(j+1)*Q.Cols])
+	}
+	softmax(weights, weights)
+}
+
+// backwardAttention propagates the gradient of the weighted sum of the rows of V for the i-th row of K
+func backwardAttention(Q, K, V *Value, i int, weights, dout []float32) {
+	cols := V.X.Cols
+	da := make([]float32, Q.X.Rows)
+	sum := float32(0)
+	for j := range da {
+		v, dv := V.X.Data[j*cols:(j+1)*cols], V.D[j*cols:(j+1)*cols]
+		for c, d := range dout {
+			dv[c] += weights[j] * d
+			da[j] += d * v[c]
+		}
+		sum += weights[j] * da[j]
+	}
+	k, dk := K.X.Data[i*K.X.Cols:(i+1)*K.X.Cols], K.D[i*K.X.Cols:(i+1)*K.X.Cols]
+	for j := range da {
+		ds := weights[j] * (da[j] - sum)
+		if ds == 0 {
+			continue
+		}
+		q, dq := Q.X.Data[j*Q.X.Cols:(j+1)*Q.X.Cols], Q.D[j*Q.X.Cols:(j+1)*Q.X.Cols]
+		for l := range k {
+			dk[l] += ds * q[l]
+			dq[l] += ds * k[l]
+		}
+	}
+}
+
+// SelfAttention computes the self attention of Q, K, V like matrix.SelfAttention,
+// computing the dot products in go so that the gradients are exact
+func (t *Tape) SelfAttention(Q, K, V *Value) *Value {
+	cols := V.X.Cols
+	data, weights := make([]float32, K.X.Rows*cols), make([]float32, Q.X.Rows)
+	for i := 0; i < K.X.Rows; i++ {
+		attention(Q.X, K.X, i, weights)
+		output := data[i*cols : (i+1)*cols]
+		for j, weight := range weights {
+			for c, value := range V.X.Data[j*cols : (j+1)*cols] {
+				output[c] += weight * value
+			}
+		}
+	}
+	return t.value(cols, K.X.Rows, data, func(o *Value) {
+		for i := 0; i < K.X.Rows; i++ {
+			attention(Q.X, K.X, i, weights)
+			backwardAttention(Q, K, V, i, weights, o.D[i*o.X.Cols:(i+1)*o.X.Cols])
+		}
+	})
+}
+
+// SelfEntropy computes the self entropy of Q, K, V like matrix.SelfEntropy64 as a column of the entropies of the rows of K
+func (t *Tape) SelfEntropy(Q, K, V *Value) *Value {
+	entropies := matrix.SelfEntropy64(Q.X, K.X, V.X)
+	data := make([]float32, len(entropies))
+	for i, value := range entropies {
+		data[i] = float32(value)
+	}
+	return t.value(1, len(data), data, func(o *Value) {
+		weights := make([]float32, Q.X.Rows)
+		e, du := make([]float32, V.X.Cols), make([]float32, V.X.Cols)
+		for i := 0; i < K.X.Rows; i++ {
+			attention(Q.X, K.X, i, weights)
+			for c := range e {
+				e[c] = 0
+				for j, weight := range weights {
+					e[c] += weight * V.X.Data[j*V.X.Cols+c]
+				}
+			}
+			softmax(e, e)
+			sum := float32(0)
+			for c, value := range e {
+				du[c] = -o.D[i] * (float32(math.Log(float64(value))) + 1)
+				sum += value * du[c]
+			}
+			for c, value := range e {
+				du[c] = value * (du[c] - sum)
+			}
+			backwardAttention(Q, K, V, i, weights, du)
+		}
+	})
+}
+
+// Scale multiplies the elements of m by s
+func (t *Tape) Scale(m *Value, s float32) *Value {
+	data := make([]float32, len(m.X.Data))
+	for i, value := range m.X.Data {
+		data[i] = s * value
+	}
+	return t.value(m.X.Cols, m.X.Rows, data, func(o *Value) {
+		for i, d := range o.D {
+			m.D[i] += s * d
+		}
+	})
+}
+
+// Sum is the sum of the elements of m
+func (t *Tape) Sum(m *Value) *Value {
+	sum := float32(0)
+	for _, value := range m.X.Data {
+		sum += value
+	}
+	return t.value(1, 1, []float32{sum}, func(o *Value) {
+		for i := range m.D {
+			m.D[i] += o.D[0]
+		}
+	})
+}
+
+// MSE is the mean squared error of m and n
+func (t *Tape) MSE(m, n *Value) *Value {
+	if len(m.X.Data) != len(n.X.Data) {
+		panic(fmt.Errorf("%d != %d", len(m.X.Data), len(n.X.Data)))
+	}
+	sum := float32(0)
+	for i, value := range m.X.Data {
+		diff := value - n.X.Data[i]
+		sum += diff * diff
+	}
+	count := float32(len(m.X.Data))
+	return t.value(1, 1, []float32{sum / count}, func(o *Value) {
+		for i, value := range m.X.Data {
+			d := 2 * (value - n.X.Data[i]) / count * o.D[0]
+			m.D[i] += d
+			n.D[i] -= d
+		}
+	})
+}
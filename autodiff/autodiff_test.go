@@ -0,0 +1,127 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autodiff
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/matrix"
+)
+
+// random creates a cols by rows matrix of values at least .1 away from zero
+func random(rng *rand.Rand, cols, rows int) matrix.Matrix {
+	m := matrix.NewMatrix(cols, rows, make([]float32, cols*rows)...)
+	for i := range m.Data {
+		value := rng.NormFloat64()
+		if math.Abs(value) < .1 {
+			value = math.Copysign(.1, value)
+		}
+		m.Data[i] = float32(value)
+	}
+	return m
+}
+
+// check compares the gradients of the projection of the output of op onto random
+// weights with the central finite differences of the inputs
+func check(t *testing.T, name string, op func(t *Tape, vars []*Value) *Value, inputs ...matrix.Matrix) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	var weights matrix.Matrix
+	loss := func() (*Tape, []*Value, *Value) {
+		tape := NewTape()
+		vars := make([]*Value, len(inputs))
+		for i, input := range inputs {
+			vars[i] = tape.Var(input)
+		}
+		output := op(tape, vars)
+		if weights.Data == nil {
+			weights = random(rng, output.X.Cols, output.X.Rows)
+		}
+		return tape, vars, tape.Sum(tape.H(output, tape.Var(weights)))
+	}
+	tape, vars, l := loss()
+	tape.Backward(l)
+	const eps = 1e-2
+	for i, input := range inputs {
+		for j := range input.Data {
+			value := input.Data[j]
+			input.Data[j] = value + eps
+			_, _, plus := loss()
+			input.Data[j] = value - eps
+			_, _, minus := loss()
+			input.Data[j] = value
+			numerical := (float64(plus.X.Data[0]) - float64(minus.X.Data[0])) / (2 * eps)
+			analytical := float64(vars[i].D[j])
+			if math.Abs(numerical-analytical) > 1e-2*math.Max(1, math.Abs(numerical)) {
+				t.Errorf("%s: input %d element %d gradient %f != %f", name, i, j, analytical, numerical)
+			}
+		}
+	}
+}
+
+func TestGradients(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	check(t, "MulT", func(t *Tape, v []*Value) *Value {
+		return t.MulT(v[0], v[1])
+	}, random(rng, 5, 3), random(rng, 5, 4))
+	check(t, "Add", func(t *Tape, v []*Value) *Value {
+		return t.Add(v[0], v[1])
+	}, random(rng, 4, 3), random(rng, 4, 1))
+	check(t, "H", func(t *Tape, v []*Value) *Value {
+		return t.H(v[0], v[1])
+	}, random(rng, 4, 3), random(rng, 4, 3))
+	check(t, "Sigmoid", func(t *Tape, v []*Value) *Value {
+		return t.Sigmoid(v[0])
+	}, random(rng, 4, 3))
+	check(t, "Everett", func(t *Tape, v []*Value) *Value {
+		return t.Everett(v[0])
+	}, random(rng, 4, 3))
+	check(t, "Concat", func(t *Tape, v []*Value) *Value {
+		return t.Concat(v[0], v[1])
+	}, random(rng, 4, 3), random(rng, 4, 2))
+	check(t, "Softmax", func(t *Tape, v []*Value) *Value {
+		return t.Softmax(v[0], 3, 5)
+	}, random(rng, 8, 2))
+	check(t, "SelfAttention", func(t *Tape, v []*Value) *Value {
+		return t.SelfAttention(v[0], v[1], v[2])
+	}, random(rng, 4, 3), random(rng, 4, 2), random(rng, 5, 3))
+	check(t, "SelfEntropy", func(t *Tape, v []*Value) *Value {
+		return t.SelfEntropy(v[0], v[1], v[2])
+	}, random(rng, 4, 3), random(rng, 4, 3), random(rng, 5, 3))
+	check(t, "Scale", func(t *Tape, v []*Value) *Value {
+		return t.Scale(v[0], -3)
+	}, random(rng, 4, 3))
+	check(t, "MSE", func(t *Tape, v []*Value) *Value {
+		return t.MSE(v[0], v[1])
+	}, random(rng, 4, 3), random(rng, 4, 3))
+}
+
+func TestForward(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	// The vectorized dot product of the matrix package is exact for lengths that are multiples of 8
+	Q, K, V := random(rng, 8, 8), random(rng, 8, 8), random(rng, 8, 8)
+	tape := NewTape()
+	q, k, v := tape.Var(Q), tape.Var(K), tape.Var(V)
+	same := func(name string, a, b []float32) {
+		if len(a) != len(b) {
+			t.Fatalf("%s: %d != %d values", name, len(a), len(b))
+		}
+		for i := range a {
+			if math.Abs(float64(a[i]-b[i])) > 1e-4 {
+				t.Errorf("%s: value %d %f != %f", name, i, a[i], b[i])
+			}
+		}
+	}
+	same("MulT", tape.MulT(q, k).X.Data, Q.MulT(K).Data)
+	same("SelfAttention", tape.SelfAttention(q, k, v).X.Data, matrix.SelfAttention(Q, K, V).Data)
+	entropies := matrix.SelfEntropy64(Q, K, V)
+	expected := make([]float32, len(entropies))
+	for i, value := range entropies {
+		expected[i] = float32(value)
+	}
+	same("SelfEntropy", tape.SelfEntropy(q, k, v).X.Data, expected)
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// Budget bounds an optimization by wall clock time, iterations and progress
+type Budget struct {
+	Start      time.Time
+	Time       time.Duration
+	Iterations int
+	Patience   int
+	Best       float64
+	Stalled    int
+	Reason     string
+}
+
+// NewBudget creates a new budget from the flags with a default number of iterations
+func NewBudget(iterations int) *Budget {
+	if *FlagIterations > 0 {
+		iterations = *FlagIterations
+	}
+	return &Budget{
+		Start:      time.Now(),
+		Time:       *FlagTime,
+		Iterations: iterations,
+		Patience:   *FlagPatience,
+		Best:       math.MaxFloat64,
+	}
+}
+
+// Next returns true if iteration i is within the budget
+func (b *Budget) Next(i int) bool {
+	if i >= b.Iterations {
+		b.Reason = "iterations"
+		return false
+	}
+	if b.Time > 0 && time.Since(b.Start) >= b.Time {
+		b.Reason = "time"
+		return false
+	}
+	return true
+}
+
+// Stop records the cost of an iteration and returns true if the optimization should stop.
+// solved is true when the decoded training outputs match exactly. Only the autocoder modes
+// decode their training outputs; the self attention modes only learn the test output, so
+// they pass false and stop on cost, patience, iterations or time instead
+func (b *Budget) Stop(cost float64, solved bool) bool {
+	if solved {
+		b.Reason = "solved"
+		return true
+	}
+	if cost < 1e-9 {
+		b.Reason = "cost"
+		return true
+	}
+	if cost < b.Best {
+		b.Best, b.Stalled = cost, 0
+	} else {
+		b.Stalled++
+	}
+	if b.Patience > 0 && b.Stalled >= b.Patience {
+		b.Reason = "patience"
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBudgetIterations(t *testing.T) {
+	budget := Budget{Start: time.Now(), Iterations: 3, Best: math.MaxFloat64}
+	i := 0
+	for ; budget.Next(i); i++ {
+		if budget.Stop(float64(10-i), false) {
+			t.Fatalf("stopped at %d for %s", i, budget.Reason)
+		}
+	}
+	if i != 3 || budget.Reason != "iterations" {
+		t.Errorf("stopped at %d for %s", i, budget.Reason)
+	}
+}
+
+func TestBudgetTime(t *testing.T) {
+	budget := Budget{Start: time.Now().Add(-time.Second), Time: time.Millisecond, Iterations: 100}
+	if budget.Next(0) || budget.Reason != "time" {
+		t.Errorf("the time budget did not stop: %s", budget.Reason)
+	}
+}
+
+func TestBudgetPatience(t *testing.T) {
+	budget := Budget{Start: time.Now(), Iterations: 100, Patience: 2, Best: math.MaxFloat64}
+	costs := []float64{5, 4, 4, 6}
+	for i, cost := range costs {
+		stop := budget.Stop(cost, false)
+		if stop != (i == len(costs)-1) {
+			t.Fatalf("iteration %d stop %t", i, stop)
+		}
+	}
+	if budget.Reason != "patience" || budget.Best != 4 {
+		t.Errorf("stopped for %s with best %f", budget.Reason, budget.Best)
+	}
+}
+
+func TestBudgetSolved(t *testing.T) {
+	budget := Budget{Start: time.Now(), Iterations: 100, Best: math.MaxFloat64}
+	if budget.Stop(5, false) {
+		t.Fatal("stopped without being solved")
+	}
+	if !budget.Stop(5, true) || budget.Reason != "solved" {
+		t.Errorf("did not stop when solved: %s", budget.Reason)
+	}
+	budget = Budget{Start: time.Now(), Iterations: 100, Best: math.MaxFloat64}
+	if !budget.Stop(0, false) || budget.Reason != "cost" {
+		t.Errorf("did not stop at zero cost: %s", budget.Reason)
+	}
+}
@@ -16,170 +16,145 @@ import (
 	"gonum.org/v1/plot/vg"
 )
 
-// Cluster clusters the problems
-func Cluster() {
-	rng := matrix.Rand(1)
-	sets := Load()
+// Boustrophedon creates an image of a grid with the rows in boustrophedon order
+func Boustrophedon(grid [][]byte) Image {
+	image := Image{
+		W: len(grid[0]),
+		H: len(grid),
+	}
+	direction := false
+	for j, v := range grid {
+		for i := range v {
+			if direction {
+				i = len(v) - i - 1
+			}
+			image.I = append(image.I, Pixel{
+				C: v[i],
+				X: i,
+				Y: j,
+			})
+		}
+		direction = !direction
+	}
+	return image
+}
+
+// NewPairs creates the pairs of the train examples of the sets with the rows in boustrophedon order
+func NewPairs(sets []Set) []Pair {
 	pairs := make([]Pair, 0, 8)
-	for s, set := range sets[:Size] {
+	for s, set := range sets {
 		for _, t := range set.Train {
-			direction := false
-			pair := Pair{
-				Class: s,
-				Input: Image{
-					W: len(t.Input[0]),
-					H: len(t.Input),
-				},
-				Output: Image{
-					W: len(t.Output[0]),
-					H: len(t.Output),
-				},
-			}
-			for j, v := range t.Input {
-				for i := range v {
-					if direction {
-						i = len(v) - i - 1
-					}
-					pair.Input.I = append(pair.Input.I, Pixel{
-						C: v[i],
-						X: i,
-						Y: j,
-					})
-				}
-				direction = !direction
-			}
-			direction = false
-			for j, v := range t.Output {
-				for i := range v {
-					if direction {
-						i = len(v) - i - 1
-					}
-					pair.Output.I = append(pair.Output.I, Pixel{
-						C: v[i],
-						X: i,
-						Y: j,
-					})
-				}
-				direction = !direction
-			}
-			pairs = append(pairs, pair)
+			pairs = append(pairs, Pair{
+				Class:  s,
+				Input:  Boustrophedon(t.Input),
+				Output: Boustrophedon(t.Output),
+			})
 		}
 	}
+	return pairs
+}
 
-	/*for _, pair := range pairs {
-		sort.Slice(pair.Input, func(i, j int) bool {
-			if pair.Input[i].C < pair.Input[j].C {
-				return true
-			} else if pair.Input[i].C == pair.Input[j].C {
-				if pair.Input[i].Y < pair.Input[j].Y {
-					return true
-				} else if pair.Input[i].Y == pair.Input[j].Y {
-					if pair.Input[i].X < pair.Input[j].X {
-						return true
-					}
-				}
-			}
-			return false
-		})
-		sort.Slice(pair.Output, func(i, j int) bool {
-			if pair.Output[i].C < pair.Output[j].C {
-				return true
-			} else if pair.Output[i].C == pair.Output[j].C {
-				if pair.Output[i].Y < pair.Output[j].Y {
-					return true
-				} else if pair.Output[i].Y == pair.Output[j].Y {
-					if pair.Output[i].X < pair.Output[j].X {
-						return true
-					}
-				}
-			}
-			return false
-		})
-	}*/
+// EncoderParams samples the parameters of the encoder
+func EncoderParams(sample matrix.Sample) []matrix.Matrix {
+	x1 := sample.Vars[0][0].Sample()
+	y1 := sample.Vars[0][1].Sample()
+	z1 := sample.Vars[0][2].Sample()
+	w1 := x1.Add(y1.H(z1))
 
-	process := func(sample matrix.Sample) ([][]float64, []int, []matrix.Matrix) {
-		x1 := sample.Vars[0][0].Sample()
-		y1 := sample.Vars[0][1].Sample()
-		z1 := sample.Vars[0][2].Sample()
-		w1 := x1.Add(y1.H(z1))
+	x2 := sample.Vars[1][0].Sample()
+	y2 := sample.Vars[1][1].Sample()
+	z2 := sample.Vars[1][2].Sample()
+	b1 := x2.Add(y2.H(z2))
 
-		x2 := sample.Vars[1][0].Sample()
-		y2 := sample.Vars[1][1].Sample()
-		z2 := sample.Vars[1][2].Sample()
-		b1 := x2.Add(y2.H(z2))
+	x3 := sample.Vars[2][0].Sample()
+	y3 := sample.Vars[2][1].Sample()
+	z3 := sample.Vars[2][2].Sample()
+	w2 := x3.Add(y3.H(z3))
 
-		x3 := sample.Vars[2][0].Sample()
-		y3 := sample.Vars[2][1].Sample()
-		z3 := sample.Vars[2][2].Sample()
-		w2 := x3.Add(y3.H(z3))
+	x4 := sample.Vars[3][0].Sample()
+	y4 := sample.Vars[3][1].Sample()
+	z4 := sample.Vars[3][2].Sample()
+	b2 := x4.Add(y4.H(z4))
+	return []matrix.Matrix{w1, b1, w2, b2}
+}
 
-		x4 := sample.Vars[3][0].Sample()
-		y4 := sample.Vars[3][1].Sample()
-		z4 := sample.Vars[3][2].Sample()
-		b2 := x4.Add(y4.H(z4))
-		params := []matrix.Matrix{w1, b1, w2, b2}
+// Encode encodes the input and output pixels of a pair into an embedding
+func Encode(params []matrix.Matrix, pair Pair) []float32 {
+	w1, b1, w2, b2 := params[0], params[1], params[2], params[3]
+	output := matrix.NewZeroMatrix(Output, 1)
+	for _, p := range pair.Input.I {
+		input := matrix.NewZeroMatrix(Input, 1)
+		input.Data[p.C] = 1
+		input.Data[10+p.X] = 1
+		input.Data[10+30+p.Y] = 1
+		in := matrix.NewMatrix(Input+Output, 1)
+		in.Data = append(in.Data, input.Data...)
+		in.Data = append(in.Data, output.Data...)
+		output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
+	}
+	for _, p := range pair.Output.I {
+		input := matrix.NewZeroMatrix(Input, 1)
+		input.Data[p.C] = 1
+		input.Data[10+p.X] = 1
+		input.Data[10+30+p.Y] = 1
+		input.Data[10+30+30] = 1
+		in := matrix.NewMatrix(Input+Output, 1)
+		in.Data = append(in.Data, input.Data...)
+		in.Data = append(in.Data, output.Data...)
+		output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
+	}
+	return output.Data
+}
 
-		rawData := make([][]float64, 0, 8)
-		classes := make([]int, 0, 8)
-		for _, pair := range pairs {
-			output := matrix.NewZeroMatrix(Output, 1)
-			for _, p := range pair.Input.I {
-				input := matrix.NewZeroMatrix(Input, 1)
-				input.Data[p.C] = 1
-				input.Data[10+p.X] = 1
-				input.Data[10+30+p.Y] = 1
-				in := matrix.NewMatrix(Input+Output, 1)
-				in.Data = append(in.Data, input.Data...)
-				in.Data = append(in.Data, output.Data...)
-				output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
-			}
-			for _, p := range pair.Output.I {
-				input := matrix.NewZeroMatrix(Input, 1)
-				input.Data[p.C] = 1
-				input.Data[10+p.X] = 1
-				input.Data[10+30+p.Y] = 1
-				input.Data[10+30+30] = 1
-				in := matrix.NewMatrix(Input+Output, 1)
-				in.Data = append(in.Data, input.Data...)
-				in.Data = append(in.Data, output.Data...)
-				output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
-			}
-			data := make([]float64, 0, 7)
-			for _, value := range output.Data {
-				data = append(data, float64(value))
-			}
-			rawData = append(rawData, data)
-			classes = append(classes, pair.Class)
-		}
+// Embed encodes the pairs, returning the embeddings and the classes of the pairs
+func Embed(params []matrix.Matrix, pairs []Pair) ([][]float32, []int) {
+	data := make([]float32, 0, Output*len(pairs))
+	classes := make([]int, 0, 8)
+	for _, pair := range pairs {
+		data = append(data, Encode(params, pair)...)
+		classes = append(classes, pair.Class)
+	}
+	rawData, err := kmeans.Rows(data, Output)
+	if err != nil {
+		panic(err)
+	}
+	return rawData, classes
+}
 
-		meta := matrix.NewMatrix(len(rawData), len(rawData), make([]float32, len(rawData)*len(rawData))...)
-		for i := 0; i < 100; i++ {
-			clusters, _, err := kmeans.Kmeans(int64(i+1), rawData, len(sets[:Size]), kmeans.SquaredEuclideanDistance, -1)
-			if err != nil {
-				panic(err)
-			}
-			for i := 0; i < len(rawData); i++ {
-				target := clusters[i]
-				for j, v := range clusters {
-					if v == target {
-						meta.Data[i*len(rawData)+j]++
-					}
-				}
-			}
+// Meta computes the co-association matrix of k-means clusterings of the embeddings refined by self attention
+func Meta[T kmeans.Float](rawData [][]T, k int) [][]float64 {
+	consensus, err := kmeans.Consensus(1, 100, rawData, k, kmeans.SquaredEuclidean[T], -1, *FlagWorkers)
+	if err != nil {
+		panic(err)
+	}
+	meta := matrix.NewMatrix(len(rawData), len(rawData), make([]float32, 0, len(rawData)*len(rawData))...)
+	for _, row := range consensus {
+		for _, value := range row {
+			meta.Data = append(meta.Data, float32(value))
 		}
-		meta = matrix.SelfAttention(meta, meta, meta)
+	}
+	meta = matrix.SelfAttention(meta, meta, meta)
 
-		x := make([][]float64, len(rawData))
-		for i := range x {
-			x[i] = make([]float64, len(rawData))
-			for j := range x[i] {
-				x[i][j] = float64(meta.Data[i*len(rawData)+j])
-			}
+	x := make([][]float64, len(rawData))
+	for i := range x {
+		x[i] = make([]float64, len(rawData))
+		for j := range x[i] {
+			x[i][j] = float64(meta.Data[i*len(rawData)+j])
 		}
+	}
+	return x
+}
 
-		return x, classes, params
+// TrainCluster trains the encoder to cluster the pairs into k clusters, calling
+// iteration with the best sample after each step of the optimizer
+func TrainCluster(pairs []Pair, k int, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	rng := matrix.Rand(1)
+	process := func(sample matrix.Sample) ([][]float64, []int, []matrix.Matrix) {
+		params := EncoderParams(sample)
+		rawData, classes := Embed(params, pairs)
+		return Meta(rawData, k), classes, params
 	}
-	optimizer := matrix.NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
+	optimizer := NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
 		done := make(chan bool, 8)
 		sample := func(s *matrix.Sample) {
 			meta, _, _ := process(*s)
@@ -226,29 +201,81 @@ func Cluster() {
 		fmt.Printf("\n")
 	}, matrix.NewCoord(Input+Output, Width), matrix.NewCoord(Width, 1),
 		matrix.NewCoord(2*Width, Output), matrix.NewCoord(Output, 1))
+	budget := NewBudget(33)
 	var sample matrix.Sample
-	for i := 0; i < 33; i++ {
+	for i := 0; budget.Next(i); i++ {
 		sample = optimizer.Iterate()
 		fmt.Println(i, sample.Cost)
-		cost := sample.Cost
-		if cost < 0 {
-			cost = 0
-			break
+		if iteration != nil {
+			iteration(i, sample)
 		}
-		if cost < 1e-9 {
+		if budget.Stop(sample.Cost, false) {
 			break
 		}
 	}
+	fmt.Println("stopped", budget.Reason)
+	return sample
+}
+
+// Cluster clusters the problems
+func Cluster() {
+	sets := Load()
+	pairs := NewPairs(sets[:Size])
+
+	/*for _, pair := range pairs {
+		sort.Slice(pair.Input, func(i, j int) bool {
+			if pair.Input[i].C < pair.Input[j].C {
+				return true
+			} else if pair.Input[i].C == pair.Input[j].C {
+				if pair.Input[i].Y < pair.Input[j].Y {
+					return true
+				} else if pair.Input[i].Y == pair.Input[j].Y {
+					if pair.Input[i].X < pair.Input[j].X {
+						return true
+					}
+				}
+			}
+			return false
+		})
+		sort.Slice(pair.Output, func(i, j int) bool {
+			if pair.Output[i].C < pair.Output[j].C {
+				return true
+			} else if pair.Output[i].C == pair.Output[j].C {
+				if pair.Output[i].Y < pair.Output[j].Y {
+					return true
+				} else if pair.Output[i].Y == pair.Output[j].Y {
+					if pair.Output[i].X < pair.Output[j].X {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}*/
 
 	clustersCount := len(sets[:Size])
-	meta, classes, params := process(sample)
-	clusters, _, err := kmeans.Kmeans(1, meta, clustersCount, kmeans.SquaredEuclideanDistance, -1)
-	if err != nil {
-		panic(err)
+	process := func(sample matrix.Sample) ([][]float64, []int, []matrix.Matrix) {
+		params := EncoderParams(sample)
+		rawData, classes := Embed(params, pairs)
+		return Meta(rawData, clustersCount), classes, params
 	}
+	sample := TrainCluster(pairs, clustersCount, func(i int, sample matrix.Sample) {
+		meta, classes, _ := process(sample)
+		_, metrics := EvaluateClusters(meta, classes, clustersCount)
+		PrintMetrics(metrics)
+	})
+
+	meta, classes, params := process(sample)
+	clusters, metrics := EvaluateClusters(meta, classes, clustersCount)
 	for i, v := range clusters {
 		fmt.Printf("%3d %3d %d\n", i, classes[i], v)
 	}
+	if *FlagExport != "" {
+		labels := NewLabels(sets, pairs)
+		rawData, _ := Embed(params, pairs)
+		Export(*FlagExport+"_embeddings", labels, Float64s(rawData))
+		Export(*FlagExport+"_meta", labels, meta)
+	}
 
 	var values plotter.Values
 	for _, param := range params {
@@ -269,48 +296,84 @@ func Cluster() {
 		panic(err)
 	}
 
-	ab, ba := make([][]float64, clustersCount), make([][]float64, clustersCount)
-	for i := range ab {
-		ab[i] = make([]float64, clustersCount)
-		ba[i] = make([]float64, clustersCount)
+	PrintMetrics(metrics)
+
+	if *FlagSelect != "" {
+		SelectClusters(meta, classes, clustersCount)
 	}
-	for i := range clusters {
-		a := int(classes[i])
-		b := clusters[i]
-		ab[a][b]++
-		ba[b][a]++
+}
+
+// SelectClusters selects the number of clusters of the meta matrix with the select flag,
+// printing the curves of the criteria and the metrics of the selected clustering
+func SelectClusters(meta [][]float64, classes []int, tasks int) {
+	maxK := *FlagMaxK
+	if maxK <= 0 {
+		maxK = 2 * tasks
 	}
-	entropy := 0.0
-	for i := 0; i < clustersCount; i++ {
-		entropy += (1.0 / float64(clustersCount)) * math.Log(1.0/float64(clustersCount))
+	if maxK > len(meta) {
+		maxK = len(meta)
 	}
-	fmt.Println(-entropy, -(1.0/float64(clustersCount))*math.Log(1.0/float64(clustersCount)))
-	sumAB := 0.0
-	for i := range ab {
-		entropy := 0.0
-		for _, value := range ab[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
+	selection, err := kmeans.Select(1, meta, *FlagMinK, maxK, *FlagReferences, *FlagRestarts, *FlagWorkers)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("k inertia silhouette daviesbouldin gap gaperror")
+	for i, k := range selection.K {
+		fmt.Printf("%d %f %f %f %f %f\n", k, selection.Inertia[i], selection.Silhouette[i],
+			selection.DaviesBouldin[i], selection.Gap[i], selection.GapError[i])
+	}
+	for _, criterion := range []string{"silhouette", "daviesbouldin", "gap", "elbow"} {
+		k, err := selection.Best(criterion)
+		if err != nil {
+			panic(err)
 		}
-		entropy = -entropy
-		fmt.Println("ab", i, entropy)
-		sumAB += entropy
+		fmt.Println(criterion, k)
 	}
-	sumBA := 0.0
-	for i := range ba {
-		entropy := 0.0
-		for _, value := range ba[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
+	k, err := selection.Best(*FlagSelect)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("selected", k, "clusters for", tasks, "tasks")
+	_, metrics := EvaluateClusters(meta, classes, k)
+	PrintMetrics(metrics)
+}
+
+// NewClusterer creates the clustering algorithm selected by the algorithm flag with k clusters
+func NewClusterer(k int) kmeans.Clusterer {
+	switch *FlagAlgorithm {
+	case "kmeans":
+		return kmeans.KMeans{Seed: 1, K: k, Distance: kmeans.SquaredEuclideanDistance, Threshold: -1, Workers: *FlagWorkers}
+	case "kmedoids":
+		return kmeans.KMedoids{K: k, Distance: kmeans.EuclideanDistance}
+	case "minibatch":
+		return kmeans.MiniBatch{Seed: 1, K: k, Distance: kmeans.SquaredEuclideanDistance, Batch: 32, Iterations: 100}
+	case "dbscan":
+		return kmeans.DBSCAN{Eps: *FlagEps, MinPts: *FlagMinPts, Distance: kmeans.EuclideanDistance}
+	case "agglomerative":
+		linkage, err := kmeans.ParseLinkage(*FlagLinkage)
+		if err != nil {
+			panic(err)
 		}
-		entropy = -entropy
-		fmt.Println("ba", i, entropy)
-		sumBA += entropy
+		return kmeans.Agglomerative{K: k, Linkage: linkage, Distance: kmeans.EuclideanDistance}
 	}
-	fmt.Println("sumAB", sumAB)
-	fmt.Println("sumBA", sumBA)
+	panic(fmt.Errorf("unknown algorithm %s, expected one of kmeans, kmedoids, minibatch, dbscan, agglomerative", *FlagAlgorithm))
+}
+
+// EvaluateClusters clusters the meta matrix into k clusters and evaluates them against the classes
+func EvaluateClusters(meta [][]float64, classes []int, k int) ([]int, kmeans.Metrics) {
+	clusters, err := NewClusterer(k).Cluster(meta)
+	if err != nil {
+		panic(err)
+	}
+	metrics, err := kmeans.Evaluate(classes, clusters)
+	if err != nil {
+		panic(err)
+	}
+	return clusters, metrics
+}
+
+// PrintMetrics prints the clustering metrics
+func PrintMetrics(metrics kmeans.Metrics) {
+	fmt.Printf("ari %f nmi %f homogeneity %f completeness %f vmeasure %f purity %f\n",
+		metrics.ARI, metrics.NMI, metrics.Homogeneity, metrics.Completeness, metrics.VMeasure, metrics.Purity)
 }
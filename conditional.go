@@ -0,0 +1,161 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/pointlander/matrix"
+)
+
+// Fold is a train example held out of the rest of the train examples of a task
+type Fold struct {
+	Train []Pair
+	Test  Pair
+}
+
+// NewFolds creates the leave one out folds of the train examples of the sets
+func NewFolds(sets []Set) []Fold {
+	folds := make([]Fold, 0, 8)
+	for s, set := range sets {
+		pairs := make([]Pair, 0, 8)
+		for _, t := range set.Train {
+			pairs = append(pairs, Pair{
+				Class:  s,
+				Input:  Boustrophedon(t.Input),
+				Output: Boustrophedon(t.Output),
+			})
+		}
+		for i := range pairs {
+			train := make([]Pair, 0, len(pairs)-1)
+			train = append(train, pairs[:i]...)
+			train = append(train, pairs[i+1:]...)
+			folds = append(folds, Fold{
+				Train: train,
+				Test:  pairs[i],
+			})
+		}
+	}
+	return folds
+}
+
+// EncodeTask encodes the train pairs of a task followed by a test input into an embedding
+func EncodeTask(params []matrix.Matrix, train []Pair, input Image) []float32 {
+	w1, b1, w2, b2 := params[0], params[1], params[2], params[3]
+	output := matrix.NewZeroMatrix(Output, 1)
+	step := func(p Pixel, flag bool) {
+		input := matrix.NewZeroMatrix(Input, 1)
+		input.Data[p.C] = 1
+		input.Data[10+p.X] = 1
+		input.Data[10+30+p.Y] = 1
+		if flag {
+			input.Data[10+30+30] = 1
+		}
+		in := matrix.NewMatrix(Input+Output, 1)
+		in.Data = append(in.Data, input.Data...)
+		in.Data = append(in.Data, output.Data...)
+		output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2).Sigmoid()
+	}
+	for _, pair := range train {
+		for _, p := range pair.Input.I {
+			step(p, false)
+		}
+		for _, p := range pair.Output.I {
+			step(p, true)
+		}
+	}
+	for _, p := range input.I {
+		step(p, false)
+	}
+	return output.Data
+}
+
+// Conditional is the conditional encoder decoder model, which encodes the train
+// pairs and test input of a task and decodes the test output
+func Conditional() {
+	rng := matrix.Rand(1)
+	sets := Load()
+	folds := NewFolds(sets[:Size])
+
+	process := func(sample matrix.Sample) ([]matrix.Matrix, []matrix.Matrix) {
+		encoder := EncoderParams(sample)
+		decoder := DecoderParams(matrix.Sample{Vars: sample.Vars[4:]})
+		return encoder, decoder
+	}
+	optimizer := NewOptimizer(&rng, 4, .1, 8, func(samples []matrix.Sample, x ...matrix.Matrix) {
+		done := make(chan bool, 8)
+		sample := func(s *matrix.Sample) {
+			encoder, decoder := process(*s)
+			cost := 0.0
+			for _, fold := range folds {
+				cost += DecodeLoss(decoder, EncodeTask(encoder, fold.Train, fold.Test.Input), fold.Test.Output)
+			}
+			s.Cost = cost / float64(len(folds))
+			done <- true
+		}
+		index, flight, cpus := 0, 0, runtime.NumCPU()
+		for flight < cpus && index < len(samples) {
+			go sample(&samples[index])
+			index++
+			flight++
+		}
+		for index < len(samples) {
+			<-done
+			flight--
+			fmt.Printf(".")
+
+			go sample(&samples[index])
+			index++
+			flight++
+		}
+		for i := 0; i < flight; i++ {
+			<-done
+			fmt.Printf(".")
+		}
+		fmt.Printf("\n")
+	}, matrix.NewCoord(Input+Output, Width), matrix.NewCoord(Width, 1),
+		matrix.NewCoord(2*Width, Output), matrix.NewCoord(Output, 1),
+		matrix.NewCoord(Output, Width), matrix.NewCoord(Width, 1),
+		matrix.NewCoord(2*Width, Input+Output), matrix.NewCoord(Input+Output, 1))
+	budget := NewBudget(128)
+	var sample matrix.Sample
+	for i := 0; budget.Next(i); i++ {
+		sample = optimizer.Iterate()
+		fmt.Println(i, sample.Cost)
+		if budget.Stop(sample.Cost, false) {
+			break
+		}
+	}
+	fmt.Println("stopped", budget.Reason)
+
+	encoder, decoder := process(sample)
+	exact, total := 0, 0
+	for s, set := range sets[:Size] {
+		train := make([]Pair, 0, 8)
+		for _, t := range set.Train {
+			train = append(train, Pair{
+				Class:  s,
+				Input:  Boustrophedon(t.Input),
+				Output: Boustrophedon(t.Output),
+			})
+		}
+		for t, test := range set.Test {
+			input := Boustrophedon(test.Input)
+			w, h := PredictSize(train, input)
+			grid := Generate(decoder, EncodeTask(encoder, train, input), w, h)
+			accuracy, ok := test.Output.Score(grid)
+			fmt.Println(set.Name, t, "accuracy", accuracy, "exact", ok)
+			if ok {
+				exact++
+			}
+			total++
+		}
+	}
+	fmt.Println("exact", exact, "of", total)
+	if err := SaveParams(*FlagDecoder, append(encoder, decoder...)); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pointlander/matrix"
+)
+
+// Trace is the forward pass of a model on an optimization
+type Trace struct {
+	Opt Tokens
+	// Hidden is the input of the self attention
+	Hidden matrix.Matrix
+	// Reconstruction is the model's reconstruction of the rows of the optimization
+	Reconstruction matrix.Matrix
+	Q, K, V        matrix.Matrix
+}
+
+// Cost is the cost of the traces of the optimizations of a set
+type Cost func(traces []Trace) float64
+
+// Costs is the registry of cost functions
+var Costs = map[string]Cost{
+	"entropy":     EntropyCost,
+	"mse":         MSECost,
+	"xent":        CrossEntropyCost,
+	"consistency": ConsistencyCost,
+}
+
+// EntropyCost is the summed self entropy of the self attention
+func EntropyCost(traces []Trace) float64 {
+	sum := 0.0
+	for _, trace := range traces {
+		hidden := trace.Hidden
+		entropy := matrix.SelfEntropy64(trace.Q.MulT(hidden), trace.K.MulT(hidden), trace.V.MulT(hidden))
+		for _, e := range entropy {
+			sum += e
+		}
+	}
+	return sum
+}
+
+// MSECost is the mean squared error of the reconstruction of the optimizations
+func MSECost(traces []Trace) float64 {
+	total, count := 0.0, 0.0
+	for _, trace := range traces {
+		out := trace.Reconstruction
+		for j := 0; j < out.Rows; j++ {
+			for k := 0; k < out.Cols; k++ {
+				diff := out.Data[j*out.Cols+k] - trace.Opt.Opt.Data[j*out.Cols+k]
+				total += float64(diff * diff)
+				count++
+			}
+		}
+	}
+	return total / count
+}
+
+// CrossEntropyCost is the mean cross entropy of the reconstructed colors and the color one-hots of the optimizations
+func CrossEntropyCost(traces []Trace) float64 {
+	total, count := 0.0, 0.0
+	for _, trace := range traces {
+		out := trace.Reconstruction
+		for j := 0; j < out.Rows; j++ {
+			row := out.Data[j*out.Cols : j*out.Cols+10]
+			target := argmax(trace.Opt.Opt.Data[j*out.Cols : j*out.Cols+10])
+			max := float64(row[0])
+			for _, value := range row {
+				if v := float64(value); v > max {
+					max = v
+				}
+			}
+			sum := 0.0
+			for _, value := range row {
+				sum += math.Exp(float64(value) - max)
+			}
+			total += math.Log(sum) + max - float64(row[target])
+			count++
+		}
+	}
+	return total / count
+}
+
+// ConsistencyCost is the mean squared deviation of the reconstructions of the
+// target from each train pair, which should agree as they share the test output
+func ConsistencyCost(traces []Trace) float64 {
+	if len(traces) < 2 {
+		return 0
+	}
+	cols := traces[0].Reconstruction.Cols
+	size := traces[0].Opt.Size * cols
+	mean := make([]float64, size)
+	for _, trace := range traces {
+		offset := trace.Opt.Offset * cols
+		for k, value := range trace.Reconstruction.Data[offset : offset+size] {
+			mean[k] += float64(value)
+		}
+	}
+	for k := range mean {
+		mean[k] /= float64(len(traces))
+	}
+	total := 0.0
+	for _, trace := range traces {
+		offset := trace.Opt.Offset * cols
+		for k, value := range trace.Reconstruction.Data[offset : offset+size] {
+			diff := float64(value) - mean[k]
+			total += diff * diff
+		}
+	}
+	return total / float64(len(traces)*size)
+}
+
+// ParseCost parses a comma separated list of weighted costs such as "mse:1,xent:0.5"
+func ParseCost(spec string) (Cost, error) {
+	type Term struct {
+		Cost   Cost
+		Weight float64
+	}
+	terms := make([]Term, 0, 8)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight := part, 1.0
+		if i := strings.Index(part, ":"); i >= 0 {
+			name = strings.TrimSpace(part[:i])
+			w, err := strconv.ParseFloat(strings.TrimSpace(part[i+1:]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight for cost %s: %w", name, err)
+			}
+			weight = w
+		}
+		cost, ok := Costs[name]
+		if !ok {
+			names := make([]string, 0, len(Costs))
+			for name := range Costs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown cost %s, expected one of %s", name, strings.Join(names, ", "))
+		}
+		terms = append(terms, Term{Cost: cost, Weight: weight})
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("no cost in %q", spec)
+	}
+	return func(traces []Trace) float64 {
+		sum := 0.0
+		for _, term := range terms {
+			sum += term.Weight * term.Cost(traces)
+		}
+		return sum
+	}, nil
+}
+
+// NewCost parses the cost flag, falling back to the cost of the mode when it is not set
+func NewCost(fallback string) Cost {
+	spec := *FlagCost
+	if spec == "" {
+		spec = fallback
+	}
+	cost, err := ParseCost(spec)
+	if err != nil {
+		panic(err)
+	}
+	return cost
+}
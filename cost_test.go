@@ -0,0 +1,141 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pointlander/matrix"
+)
+
+// testTraces returns the traces of two optimizations of three color tokens whose last
+// row is the target, with reconstructions that are off by .5 in two cells
+func testTraces() []Trace {
+	qkv := func(a int) matrix.Matrix {
+		m := matrix.NewMatrix(10, 10)
+		for i := 0; i < 100; i++ {
+			m.Data = append(m.Data, float32((i*a)%11-5)/10)
+		}
+		return m
+	}
+	q, k, v := qkv(7), qkv(3), qkv(5)
+	colors := [][]int{{0, 5, 2}, {1, 7, 0}}
+	traces := make([]Trace, len(colors))
+	for i := range traces {
+		opt, reconstruction := matrix.NewZeroMatrix(10, 3), matrix.NewZeroMatrix(10, 3)
+		for j, color := range colors[i] {
+			opt.Data[10*j+color] = 1
+			reconstruction.Data[10*j+color] = 1
+		}
+		traces[i] = Trace{
+			Opt:            Tokens{Opt: opt, Offset: 2, Size: 1},
+			Hidden:         reconstruction,
+			Reconstruction: reconstruction,
+			Q:              q,
+			K:              k,
+			V:              v,
+		}
+	}
+	traces[0].Reconstruction.Data[10*2+2], traces[0].Reconstruction.Data[10*2+3] = .5, .5
+	traces[1].Reconstruction.Data[10*1+7], traces[1].Reconstruction.Data[10*1+6] = .5, .5
+	return traces
+}
+
+func TestCosts(t *testing.T) {
+	traces := testTraces()
+	if cost, expected := MSECost(traces), 4*.25/60; math.Abs(cost-expected) > 1e-9 {
+		t.Errorf("mse %f, expected %f", cost, expected)
+	}
+	// The target rows [0 0 .5 .5 ...] and [1 0 0 0 ...] deviate from their mean by .5, .25 and .25
+	if cost, expected := ConsistencyCost(traces), 2*(.25+.0625+.0625)/20; math.Abs(cost-expected) > 1e-9 {
+		t.Errorf("consistency %f, expected %f", cost, expected)
+	}
+	if cost := ConsistencyCost(traces[:1]); cost != 0 {
+		t.Errorf("consistency of one trace %f", cost)
+	}
+	// Four rows are one hot on the target and two have .5 on the target and on another color
+	exact, half := math.Log(9+math.E)-1, math.Log(8+2*math.Exp(.5))-.5
+	if cost, expected := CrossEntropyCost(traces), (4*exact+2*half)/6; math.Abs(cost-expected) > 1e-6 {
+		t.Errorf("cross entropy %f, expected %f", cost, expected)
+	}
+	if cost := EntropyCost(traces); cost == 0 || math.IsNaN(cost) {
+		t.Errorf("entropy %f", cost)
+	}
+}
+
+func TestParseCost(t *testing.T) {
+	traces := testTraces()
+	entropy, mse, xent := EntropyCost(traces), MSECost(traces), CrossEntropyCost(traces)
+	tests := []struct {
+		spec string
+		cost float64
+	}{
+		{"entropy", entropy},
+		{"mse:2", 2 * mse},
+		{"entropy:1,mse:0.5", entropy + .5*mse},
+		{" mse : 0.25 , xent ,", .25*mse + xent},
+		{"mse:1,mse:1", 2 * mse},
+		{"xent:0", 0},
+	}
+	for _, test := range tests {
+		cost, err := ParseCost(test.spec)
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		if value := cost(traces); math.Abs(value-test.cost) > 1e-9 {
+			t.Errorf("%q is %f, expected %f", test.spec, value, test.cost)
+		}
+	}
+}
+
+func TestParseCostErrors(t *testing.T) {
+	tests := []struct {
+		spec  string
+		error string
+	}{
+		{"", "no cost"},
+		{" , ", "no cost"},
+		{"l1", "unknown cost l1, expected one of consistency, entropy, mse, xent"},
+		{"mse:1,huber:2", "unknown cost huber"},
+		{"mse:x", "invalid weight for cost mse"},
+		{"entropy:1:2", "invalid weight for cost entropy"},
+	}
+	for _, test := range tests {
+		_, err := ParseCost(test.spec)
+		if err == nil {
+			t.Errorf("%q parsed", test.spec)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q: %v", test.spec, err)
+		}
+	}
+}
+
+func TestNewCost(t *testing.T) {
+	traces := testTraces()
+	defer func(spec string) {
+		*FlagCost = spec
+	}(*FlagCost)
+
+	*FlagCost = ""
+	if cost := NewCost("mse")(traces); cost != MSECost(traces) {
+		t.Errorf("the fallback cost is %f", cost)
+	}
+	*FlagCost = "xent:2"
+	if cost := NewCost("mse")(traces); cost != 2*CrossEntropyCost(traces) {
+		t.Errorf("the flag cost is %f", cost)
+	}
+	*FlagCost = "nope"
+	defer func() {
+		if recover() == nil {
+			t.Error("an invalid cost flag did not panic")
+		}
+	}()
+	NewCost("mse")
+}
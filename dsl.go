@@ -0,0 +1,477 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Primitive is a grid transformation of the dsl
+type Primitive struct {
+	Name string
+	F    func(grid [][]byte) ([][]byte, bool)
+}
+
+// Program is a composition of primitives
+type Program []Primitive
+
+// Apply applies the program to a grid
+func (p Program) Apply(grid [][]byte) ([][]byte, bool) {
+	ok := true
+	for _, primitive := range p {
+		grid, ok = primitive.F(grid)
+		if !ok {
+			return nil, false
+		}
+	}
+	return grid, true
+}
+
+// String returns the program as a string
+func (p Program) String() string {
+	names := make([]string, len(p))
+	for i, primitive := range p {
+		names[i] = primitive.Name
+	}
+	return strings.Join(names, " | ")
+}
+
+// newGrid creates a w by h grid filled with color
+func newGrid(w, h int, color byte) ([][]byte, bool) {
+	if w < 1 || h < 1 || w > 30 || h > 30 {
+		return nil, false
+	}
+	grid := make([][]byte, h)
+	for j := range grid {
+		grid[j] = make([]byte, w)
+		for i := range grid[j] {
+			grid[j][i] = color
+		}
+	}
+	return grid, true
+}
+
+// transform creates a grid of size w by h with cells taken from the grid by f
+func transform(grid [][]byte, w, h int, f func(x, y int) byte) ([][]byte, bool) {
+	output, ok := newGrid(w, h, 0)
+	if !ok {
+		return nil, false
+	}
+	for y := range output {
+		for x := range output[y] {
+			output[y][x] = f(x, y)
+		}
+	}
+	return output, true
+}
+
+// FlipX mirrors the grid left to right
+func FlipX(grid [][]byte) ([][]byte, bool) {
+	w, h := len(grid[0]), len(grid)
+	return transform(grid, w, h, func(x, y int) byte {
+		return grid[y][w-x-1]
+	})
+}
+
+// FlipY mirrors the grid top to bottom
+func FlipY(grid [][]byte) ([][]byte, bool) {
+	w, h := len(grid[0]), len(grid)
+	return transform(grid, w, h, func(x, y int) byte {
+		return grid[h-y-1][x]
+	})
+}
+
+// Transpose transposes the grid
+func Transpose(grid [][]byte) ([][]byte, bool) {
+	w, h := len(grid[0]), len(grid)
+	return transform(grid, h, w, func(x, y int) byte {
+		return grid[x][y]
+	})
+}
+
+// Rotate rotates the grid clockwise by 90 degrees
+func Rotate(grid [][]byte) ([][]byte, bool) {
+	w, h := len(grid[0]), len(grid)
+	return transform(grid, h, w, func(x, y int) byte {
+		return grid[h-x-1][y]
+	})
+}
+
+// Crop crops the grid to the bounding box of the cells that are not the background
+func Crop(grid [][]byte) ([][]byte, bool) {
+	background := NewImage(grid).Background()
+	minX, minY, maxX, maxY := len(grid[0]), len(grid), -1, -1
+	for y, row := range grid {
+		for x, value := range row {
+			if value == background {
+				continue
+			}
+			if x < minX {
+				minX = x
+			}
+			if y < minY {
+				minY = y
+			}
+			if x > maxX {
+				maxX = x
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+	}
+	if maxX < 0 {
+		return nil, false
+	}
+	return transform(grid, maxX-minX+1, maxY-minY+1, func(x, y int) byte {
+		return grid[minY+y][minX+x]
+	})
+}
+
+// CropObject crops the grid to the largest or smallest object
+func CropObject(largest bool) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		image := NewImage(grid)
+		objects := image.Objects(image.Background(), true, true)
+		if len(objects) == 0 {
+			return nil, false
+		}
+		selected := objects[0]
+		for _, object := range objects[1:] {
+			if (largest && object.Size() > selected.Size()) || (!largest && object.Size() < selected.Size()) {
+				selected = object
+			}
+		}
+		return transform(grid, selected.W, selected.H, func(x, y int) byte {
+			return grid[selected.Y+y][selected.X+x]
+		})
+	}
+}
+
+// Tile tiles the grid nx by ny times, mirroring alternate tiles if mirror is set
+func Tile(nx, ny int, mirror bool) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		w, h := len(grid[0]), len(grid)
+		return transform(grid, nx*w, ny*h, func(x, y int) byte {
+			tx, ty, xx, yy := x/w, y/h, x%w, y%h
+			if mirror && tx%2 == 1 {
+				xx = w - xx - 1
+			}
+			if mirror && ty%2 == 1 {
+				yy = h - yy - 1
+			}
+			return grid[yy][xx]
+		})
+	}
+}
+
+// Scale scales the grid up by a factor
+func Scale(factor int) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		w, h := len(grid[0]), len(grid)
+		return transform(grid, factor*w, factor*h, func(x, y int) byte {
+			return grid[y/factor][x/factor]
+		})
+	}
+}
+
+// Recolor replaces the color from with the color to
+func Recolor(from, to byte) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		return transform(grid, len(grid[0]), len(grid), func(x, y int) byte {
+			if grid[y][x] == from {
+				return to
+			}
+			return grid[y][x]
+		})
+	}
+}
+
+// FloodFill fills the background regions that are enclosed and do not touch the border with color
+func FloodFill(color byte) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		w, h := len(grid[0]), len(grid)
+		background := NewImage(grid).Background()
+		outside := make([][]bool, h)
+		for j := range outside {
+			outside[j] = make([]bool, w)
+		}
+		stack := make([][2]int, 0, 8)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if (x == 0 || y == 0 || x == w-1 || y == h-1) && grid[y][x] == background {
+					outside[y][x] = true
+					stack = append(stack, [2]int{x, y})
+				}
+			}
+		}
+		for len(stack) > 0 {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, n := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				x, y := p[0]+n[0], p[1]+n[1]
+				if x < 0 || y < 0 || x >= w || y >= h || outside[y][x] || grid[y][x] != background {
+					continue
+				}
+				outside[y][x] = true
+				stack = append(stack, [2]int{x, y})
+			}
+		}
+		filled := false
+		output, _ := transform(grid, w, h, func(x, y int) byte {
+			if grid[y][x] == background && !outside[y][x] {
+				filled = true
+				return color
+			}
+			return grid[y][x]
+		})
+		return output, filled
+	}
+}
+
+// Gravity moves the cells that are not the background as far as possible in direction dx, dy
+func Gravity(dx, dy int) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		w, h := len(grid[0]), len(grid)
+		background := NewImage(grid).Background()
+		output, _ := transform(grid, w, h, func(x, y int) byte {
+			return grid[y][x]
+		})
+		for moved := true; moved; {
+			moved = false
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					xx, yy := x+dx, y+dy
+					if xx < 0 || yy < 0 || xx >= w || yy >= h {
+						continue
+					}
+					if output[y][x] != background && output[yy][xx] == background {
+						output[yy][xx], output[y][x] = output[y][x], background
+						moved = true
+					}
+				}
+			}
+		}
+		return output, true
+	}
+}
+
+// Move moves the cells of color as a rigid body in direction dx, dy until they hit the border or another cell
+func Move(color byte, dx, dy int) func(grid [][]byte) ([][]byte, bool) {
+	return func(grid [][]byte) ([][]byte, bool) {
+		w, h := len(grid[0]), len(grid)
+		background := NewImage(grid).Background()
+		if color == background {
+			return nil, false
+		}
+		cells := make([][2]int, 0, 8)
+		for y, row := range grid {
+			for x, value := range row {
+				if value == color {
+					cells = append(cells, [2]int{x, y})
+				}
+			}
+		}
+		if len(cells) == 0 {
+			return nil, false
+		}
+		steps := 0
+		for {
+			blocked := false
+			for _, cell := range cells {
+				x, y := cell[0]+(steps+1)*dx, cell[1]+(steps+1)*dy
+				if x < 0 || y < 0 || x >= w || y >= h || (grid[y][x] != background && grid[y][x] != color) {
+					blocked = true
+					break
+				}
+			}
+			if blocked {
+				break
+			}
+			steps++
+		}
+		if steps == 0 {
+			return nil, false
+		}
+		output, _ := transform(grid, w, h, func(x, y int) byte {
+			if grid[y][x] == color {
+				return background
+			}
+			return grid[y][x]
+		})
+		for _, cell := range cells {
+			output[cell[1]+steps*dy][cell[0]+steps*dx] = color
+		}
+		return output, true
+	}
+}
+
+// Primitives returns the library of dsl primitives
+func Primitives() []Primitive {
+	primitives := []Primitive{
+		{"flipx", FlipX},
+		{"flipy", FlipY},
+		{"transpose", Transpose},
+		{"rotate", Rotate},
+		{"crop", Crop},
+		{"largest", CropObject(true)},
+		{"smallest", CropObject(false)},
+		{"gravity down", Gravity(0, 1)},
+		{"gravity up", Gravity(0, -1)},
+		{"gravity left", Gravity(-1, 0)},
+		{"gravity right", Gravity(1, 0)},
+	}
+	for _, n := range [][2]int{{2, 1}, {1, 2}, {2, 2}, {3, 3}} {
+		primitives = append(primitives,
+			Primitive{fmt.Sprintf("tile %dx%d", n[0], n[1]), Tile(n[0], n[1], false)},
+			Primitive{fmt.Sprintf("mirror %dx%d", n[0], n[1]), Tile(n[0], n[1], true)})
+	}
+	for factor := 2; factor <= 3; factor++ {
+		primitives = append(primitives, Primitive{fmt.Sprintf("scale %d", factor), Scale(factor)})
+	}
+	directions := []struct {
+		Name   string
+		DX, DY int
+	}{{"down", 0, 1}, {"up", 0, -1}, {"left", -1, 0}, {"right", 1, 0}}
+	for color := byte(0); color < 10; color++ {
+		primitives = append(primitives, Primitive{fmt.Sprintf("fill %d", color), FloodFill(color)})
+		for to := byte(0); to < 10; to++ {
+			if to != color {
+				primitives = append(primitives, Primitive{fmt.Sprintf("recolor %d %d", color, to), Recolor(color, to)})
+			}
+		}
+		for _, d := range directions {
+			primitives = append(primitives, Primitive{fmt.Sprintf("move %d %s", color, d.Name), Move(color, d.DX, d.DY)})
+		}
+	}
+	return primitives
+}
+
+// Search searches breadth first for up to limit programs of at most depth primitives
+// that map every train input to its output
+func Search(train []Example, depth, limit int) []Program {
+	type Node struct {
+		Program Program
+		Grids   [][][]byte
+	}
+	key := func(grids [][][]byte) string {
+		var b strings.Builder
+		for _, grid := range grids {
+			for _, row := range grid {
+				b.Write(row)
+				b.WriteByte(255)
+			}
+			b.WriteByte(254)
+		}
+		return b.String()
+	}
+	matches := func(grids [][][]byte) bool {
+		for i, grid := range grids {
+			if !Equal(grid, train[i].Output) {
+				return false
+			}
+		}
+		return true
+	}
+	root := Node{Grids: make([][][]byte, len(train))}
+	for i, t := range train {
+		root.Grids[i] = t.Input
+	}
+	primitives := Primitives()
+	seen := map[string]bool{key(root.Grids): true}
+	programs := make([]Program, 0, limit)
+	if matches(root.Grids) {
+		programs = append(programs, Program{})
+	}
+	frontier := []Node{root}
+	for d := 0; d < depth && len(programs) < limit; d++ {
+		next := make([]Node, 0, 8)
+		for _, node := range frontier {
+			for _, primitive := range primitives {
+				grids, ok := make([][][]byte, len(node.Grids)), true
+				for i, grid := range node.Grids {
+					grids[i], ok = primitive.F(grid)
+					if !ok {
+						break
+					}
+				}
+				if !ok {
+					continue
+				}
+				k := key(grids)
+				if seen[k] {
+					continue
+				}
+				seen[k] = true
+				program := make(Program, len(node.Program), len(node.Program)+1)
+				copy(program, node.Program)
+				program = append(program, primitive)
+				if matches(grids) {
+					programs = append(programs, program)
+					if len(programs) == limit {
+						return programs
+					}
+					continue
+				}
+				next = append(next, Node{Program: program, Grids: grids})
+			}
+		}
+		frontier = next
+	}
+	return programs
+}
+
+// DSL is the program synthesis mode
+func DSL() {
+	sets := Load()
+	solved, found, total := 0, 0, 0
+	for s, set := range sets {
+		programs := Search(set.Train, *FlagDepth, 1)
+		if len(programs) > 0 {
+			found++
+		}
+		for t, test := range set.Test {
+			total++
+			if len(programs) == 0 {
+				continue
+			}
+			grid, ok := programs[0].Apply(test.Input)
+			if !ok {
+				fmt.Println(s, set.Name, t, programs[0], "failed")
+				continue
+			}
+			_, exact := test.Output.Score(grid)
+			if exact {
+				solved++
+			}
+			fmt.Println(s, set.Name, t, programs[0], exact)
+		}
+	}
+	fmt.Println("programs", found, "of", len(sets))
+	fmt.Println("solved", solved, "of", total)
+}
+
+// ValidateDSL computes the leave one out exact match rate of the program search on the train pairs
+func ValidateDSL(train []Example, depth int) float64 {
+	if len(train) < 2 {
+		return 0
+	}
+	exact := 0
+	for h := range train {
+		fold := make([]Example, 0, len(train)-1)
+		fold = append(fold, train[:h]...)
+		fold = append(fold, train[h+1:]...)
+		programs := Search(fold, depth, 1)
+		if len(programs) == 0 {
+			continue
+		}
+		grid, ok := programs[0].Apply(train[h].Input)
+		if ok && Equal(grid, train[h].Output) {
+			exact++
+		}
+	}
+	return float64(exact) / float64(len(train))
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPrimitives(t *testing.T) {
+	grid := [][]byte{
+		{1, 2, 0},
+		{0, 3, 0},
+	}
+	frame := [][]byte{
+		{0, 0, 0, 0, 0},
+		{0, 1, 1, 1, 0},
+		{0, 1, 0, 1, 0},
+		{0, 1, 1, 1, 0},
+		{0, 0, 0, 0, 0},
+	}
+	objects := [][]byte{
+		{1, 0, 0, 0},
+		{0, 0, 2, 2},
+		{0, 0, 2, 2},
+	}
+	tests := []struct {
+		name   string
+		f      func(grid [][]byte) ([][]byte, bool)
+		input  [][]byte
+		output [][]byte
+	}{
+		{"flipx", FlipX, grid, [][]byte{{0, 2, 1}, {0, 3, 0}}},
+		{"flipy", FlipY, grid, [][]byte{{0, 3, 0}, {1, 2, 0}}},
+		{"transpose", Transpose, grid, [][]byte{{1, 0}, {2, 3}, {0, 0}}},
+		{"rotate", Rotate, grid, [][]byte{{0, 1}, {3, 2}, {0, 0}}},
+		{"crop", Crop, grid, [][]byte{{1, 2}, {0, 3}}},
+		{"largest", CropObject(true), objects, [][]byte{{2, 2}, {2, 2}}},
+		{"smallest", CropObject(false), objects, [][]byte{{1}}},
+		{"tile 2x1", Tile(2, 1, false), [][]byte{{1, 2}}, [][]byte{{1, 2, 1, 2}}},
+		{"mirror 2x1", Tile(2, 1, true), [][]byte{{1, 2}}, [][]byte{{1, 2, 2, 1}}},
+		{"mirror 1x2", Tile(1, 2, true), [][]byte{{1}, {2}}, [][]byte{{1}, {2}, {2}, {1}}},
+		{"scale 2", Scale(2), [][]byte{{1, 2}}, [][]byte{{1, 1, 2, 2}, {1, 1, 2, 2}}},
+		{"recolor 2 5", Recolor(2, 5), grid, [][]byte{{1, 5, 0}, {0, 3, 0}}},
+		{"fill 4", FloodFill(4), frame, [][]byte{
+			{0, 0, 0, 0, 0},
+			{0, 1, 1, 1, 0},
+			{0, 1, 4, 1, 0},
+			{0, 1, 1, 1, 0},
+			{0, 0, 0, 0, 0},
+		}},
+		{"gravity down", Gravity(0, 1), [][]byte{{1, 0}, {0, 0}, {0, 2}}, [][]byte{{0, 0}, {0, 0}, {1, 2}}},
+		{"gravity left", Gravity(-1, 0), [][]byte{{0, 1, 0, 2, 0}}, [][]byte{{1, 2, 0, 0, 0}}},
+		{"move 3 right", Move(3, 1, 0), [][]byte{{0, 0, 0, 0}, {3, 3, 0, 5}}, [][]byte{{0, 0, 0, 0}, {0, 3, 3, 5}}},
+		{"move 3 up", Move(3, 0, -1), [][]byte{{0, 0, 0}, {0, 0, 5}, {3, 0, 0}}, [][]byte{{3, 0, 0}, {0, 0, 5}, {0, 0, 0}}},
+	}
+	for _, test := range tests {
+		output, ok := test.f(test.input)
+		if !ok {
+			t.Errorf("%s failed", test.name)
+			continue
+		}
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%s is %v, expected %v", test.name, output, test.output)
+		}
+	}
+}
+
+func TestPrimitivesFail(t *testing.T) {
+	tests := []struct {
+		name  string
+		f     func(grid [][]byte) ([][]byte, bool)
+		input [][]byte
+	}{
+		// Nothing to crop to on a blank grid
+		{"crop", Crop, [][]byte{{0, 0}, {0, 0}}},
+		{"largest", CropObject(true), [][]byte{{0, 0}, {0, 0}}},
+		// No background region is enclosed
+		{"fill 4", FloodFill(4), [][]byte{{1, 0, 0}, {0, 0, 0}}},
+		// The grid would be larger than 30 by 30
+		{"tile 3x3", Tile(3, 3, false), make([][]byte, 11)},
+		// The color is missing, is the background, or can not move
+		{"move 3 right", Move(3, 1, 0), [][]byte{{0, 0}, {0, 1}}},
+		{"move 0 right", Move(0, 1, 0), [][]byte{{0, 0}, {0, 1}}},
+		{"move 3 left", Move(3, -1, 0), [][]byte{{3, 0}, {0, 0}}},
+	}
+	for i := range tests[3].input {
+		tests[3].input[i] = make([]byte, 11)
+	}
+	for _, test := range tests {
+		if output, ok := test.f(test.input); ok {
+			t.Errorf("%s succeeded with %v", test.name, output)
+		}
+	}
+}
+
+func TestProgram(t *testing.T) {
+	program := Program{{"flipx", FlipX}, {"recolor 1 2", Recolor(1, 2)}}
+	if s := program.String(); s != "flipx | recolor 1 2" {
+		t.Errorf("program is %s", s)
+	}
+	output, ok := program.Apply([][]byte{{1, 0, 3}})
+	if !ok || !reflect.DeepEqual(output, [][]byte{{3, 0, 2}}) {
+		t.Errorf("program applied is %v %t", output, ok)
+	}
+	if _, ok := (Program{{"crop", Crop}, {"flipx", FlipX}}).Apply([][]byte{{0, 0}}); ok {
+		t.Error("program with a failing primitive succeeded")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	program := Program{{"flipx", FlipX}, {"recolor 1 2", Recolor(1, 2)}}
+	inputs := [][][]byte{
+		{{1, 0, 3}, {0, 1, 0}, {0, 0, 4}},
+		{{1, 1, 0, 0}, {5, 0, 1, 0}},
+		{{0, 6, 1}, {1, 0, 0}, {0, 7, 0}},
+	}
+	examples := make([]Example, len(inputs))
+	for i, input := range inputs {
+		output, _ := program.Apply(input)
+		examples[i] = Example{Input: input, Output: output}
+	}
+	programs := Search(examples[:2], 2, 1)
+	if len(programs) != 1 {
+		t.Fatalf("found %d programs", len(programs))
+	}
+	if len(programs[0]) != 2 {
+		t.Errorf("found %s, expected two primitives", programs[0])
+	}
+	output, ok := programs[0].Apply(examples[2].Input)
+	if !ok || !reflect.DeepEqual(output, examples[2].Output) {
+		t.Errorf("%s maps the held out input to %v", programs[0], output)
+	}
+
+	// One primitive is not enough
+	if programs := Search(examples[:2], 1, 1); len(programs) != 0 {
+		t.Errorf("found %s with one primitive", programs[0])
+	}
+	// The identity is the empty program
+	identity := []Example{{Input: inputs[0], Output: inputs[0]}}
+	if programs := Search(identity, 2, 1); len(programs) != 1 || len(programs[0]) != 0 {
+		t.Errorf("found %v for the identity", programs)
+	}
+}
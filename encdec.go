@@ -5,8 +5,10 @@
 package main
 
 import (
+	"encoding/gob"
 	"fmt"
 	"math"
+	"os"
 	"runtime"
 
 	"github.com/pointlander/frozenstar/kmeans"
@@ -16,129 +18,117 @@ import (
 	"gonum.org/v1/plot/vg"
 )
 
-// Encdec encoder decoder model
-func Encdec() {
-	rng := matrix.Rand(1)
-	sets := Load()
-
-	pairs := make([]Pair, 0, 8)
-	for s, set := range sets[:Size] {
-		for _, t := range set.Train {
-			direction := false
-			pair := Pair{
-				Class: s,
-				Input: Image{
-					W: len(t.Input[0]),
-					H: len(t.Input),
-				},
-				Output: Image{
-					W: len(t.Output[0]),
-					H: len(t.Output),
-				},
-			}
-			for j, v := range t.Input {
-				for i := range v {
-					if direction {
-						i = len(v) - i - 1
-					}
-					pair.Input.I = append(pair.Input.I, Pixel{
-						C: v[i],
-						X: i,
-						Y: j,
-					})
-				}
-				direction = !direction
-			}
-			direction = false
-			for j, v := range t.Output {
-				for i := range v {
-					if direction {
-						i = len(v) - i - 1
-					}
-					pair.Output.I = append(pair.Output.I, Pixel{
-						C: v[i],
-						X: i,
-						Y: j,
-					})
-				}
-				direction = !direction
-			}
-			pairs = append(pairs, pair)
-		}
+// EncodeInput encodes the input pixels of a pair into an embedding
+func EncodeInput(params []matrix.Matrix, pair Pair) []float32 {
+	w1, b1, w2, b2 := params[0], params[1], params[2], params[3]
+	output := matrix.NewZeroMatrix(Output, 1)
+	for _, p := range pair.Input.I {
+		input := matrix.NewZeroMatrix(Input, 1)
+		input.Data[p.C] = 1
+		input.Data[10+p.X] = 1
+		input.Data[10+30+p.Y] = 1
+		in := matrix.NewMatrix(Input+Output, 1)
+		in.Data = append(in.Data, input.Data...)
+		in.Data = append(in.Data, output.Data...)
+		output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2).Sigmoid()
 	}
+	return output.Data
+}
 
-	process := func(sample matrix.Sample) ([][]float64, []int, []matrix.Matrix) {
-		x1 := sample.Vars[0][0].Sample()
-		y1 := sample.Vars[0][1].Sample()
-		z1 := sample.Vars[0][2].Sample()
-		w1 := x1.Add(y1.H(z1))
-
-		x2 := sample.Vars[1][0].Sample()
-		y2 := sample.Vars[1][1].Sample()
-		z2 := sample.Vars[1][2].Sample()
-		b1 := x2.Add(y2.H(z2))
+// EmbedInputs encodes the inputs of the pairs, returning the embeddings and the classes of the pairs
+func EmbedInputs(params []matrix.Matrix, pairs []Pair) ([][]float32, []int) {
+	data := make([]float32, 0, Output*len(pairs))
+	classes := make([]int, 0, 8)
+	for _, pair := range pairs {
+		data = append(data, EncodeInput(params, pair)...)
+		classes = append(classes, pair.Class)
+	}
+	rawData, err := kmeans.Rows(data, Output)
+	if err != nil {
+		panic(err)
+	}
+	return rawData, classes
+}
 
-		x3 := sample.Vars[2][0].Sample()
-		y3 := sample.Vars[2][1].Sample()
-		z3 := sample.Vars[2][2].Sample()
-		w2 := x3.Add(y3.H(z3))
+// DecoderParams samples the parameters of the decoder, which have the same layout as the encoder
+func DecoderParams(sample matrix.Sample) []matrix.Matrix {
+	return EncoderParams(sample)
+}
 
-		x4 := sample.Vars[3][0].Sample()
-		y4 := sample.Vars[3][1].Sample()
-		z4 := sample.Vars[3][2].Sample()
-		b2 := x4.Add(y4.H(z4))
-		params := []matrix.Matrix{w1, b1, w2, b2}
+// Decode runs one step of the decoder on the previous output
+func Decode(params []matrix.Matrix, output matrix.Matrix, first bool) matrix.Matrix {
+	w1, b1, w2, b2 := params[0], params[1], params[2], params[3]
+	in := matrix.NewMatrix(Output, 1)
+	in.Data = append(in.Data, output.Data[Input:]...)
+	if !first {
+		in = in.Sigmoid()
+	}
+	return w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
+}
 
-		rawData := make([][]float64, 0, 8)
-		classes := make([]int, 0, 8)
-		for _, pair := range pairs {
-			output := matrix.NewZeroMatrix(Output, 1)
-			for _, p := range pair.Input.I {
-				input := matrix.NewZeroMatrix(Input, 1)
-				input.Data[p.C] = 1
-				input.Data[10+p.X] = 1
-				input.Data[10+30+p.Y] = 1
-				in := matrix.NewMatrix(Input+Output, 1)
-				in.Data = append(in.Data, input.Data...)
-				in.Data = append(in.Data, output.Data...)
-				output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2).Sigmoid()
-			}
-			data := make([]float64, 0, 7)
-			for _, value := range output.Data {
-				data = append(data, float64(value))
-			}
-			rawData = append(rawData, data)
-			classes = append(classes, pair.Class)
+// DecodeLoss is the mean squared error of decoding the pixels of an image from a code
+func DecodeLoss(params []matrix.Matrix, code []float32, image Image) float64 {
+	output := matrix.NewZeroMatrix(Input+Output, 1)
+	copy(output.Data[Input:], code)
+	loss, count := 0.0, 0.0
+	for i, p := range image.I {
+		input := matrix.NewZeroMatrix(Input, 1)
+		input.Data[p.C] = 1
+		input.Data[10+p.X] = 1
+		input.Data[10+30+p.Y] = 1
+		output = Decode(params, output, i == 0)
+		for k := range output.Data[:Input] {
+			diff := float64(input.Data[k]) - float64(output.Data[k])
+			loss += diff * diff
+			count++
 		}
+	}
+	return loss / count
+}
 
-		meta := matrix.NewMatrix(len(rawData), len(rawData), make([]float32, len(rawData)*len(rawData))...)
-		for i := 0; i < 100; i++ {
-			clusters, _, err := kmeans.Kmeans(int64(i+1), rawData, len(sets[:Size]), kmeans.SquaredEuclideanDistance, -1)
-			if err != nil {
-				panic(err)
-			}
-			for i := 0; i < len(rawData); i++ {
-				target := clusters[i]
-				for j, v := range clusters {
-					if v == target {
-						meta.Data[i*len(rawData)+j]++
-					}
-				}
-			}
+// Generate autoregressively decodes a w by h grid from a code, placing the i-th
+// pixel at the i-th position in boustrophedon order
+func Generate(params []matrix.Matrix, code []float32, w, h int) [][]byte {
+	grid := make([][]byte, h)
+	for j := range grid {
+		grid[j] = make([]byte, w)
+	}
+	output := matrix.NewZeroMatrix(Input+Output, 1)
+	copy(output.Data[Input:], code)
+	for i := 0; i < w*h; i++ {
+		output = Decode(params, output, i == 0)
+		x, y := i%w, i/w
+		if y%2 == 1 {
+			x = w - x - 1
 		}
-		meta = matrix.SelfAttention(meta, meta, meta)
+		grid[y][x] = byte(argmax(output.Data[:10]))
+	}
+	return grid
+}
 
-		x := make([][]float64, len(rawData))
-		for i := range x {
-			x[i] = make([]float64, len(rawData))
-			for j := range x[i] {
-				x[i][j] = float64(meta.Data[i*len(rawData)+j])
-			}
-		}
+// SaveParams saves the parameters to a gob file
+func SaveParams(name string, params []matrix.Matrix) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gob.NewEncoder(file).Encode(params)
+}
+
+// Encdec encoder decoder model
+func Encdec() {
+	rng := matrix.Rand(1)
+	sets := Load()
 
-		return x, classes, params
+	pairs := NewPairs(sets[:Size])
+
+	process := func(sample matrix.Sample) ([][]float64, []int, []matrix.Matrix) {
+		params := EncoderParams(sample)
+		rawData, classes := EmbedInputs(params, pairs)
+		return Meta(rawData, len(sets[:Size])), classes, params
 	}
-	optimizer := matrix.NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
+	optimizer := NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
 		done := make(chan bool, 8)
 		sample := func(s *matrix.Sample) {
 			meta, _, _ := process(*s)
@@ -185,29 +175,32 @@ func Encdec() {
 		fmt.Printf("\n")
 	}, matrix.NewCoord(Input+Output, Width), matrix.NewCoord(Width, 1),
 		matrix.NewCoord(2*Width, Output), matrix.NewCoord(Output, 1))
+	budget := NewBudget(33)
 	var sample matrix.Sample
-	for i := 0; i < 33; i++ {
+	for i := 0; budget.Next(i); i++ {
 		sample = optimizer.Iterate()
 		fmt.Println(i, sample.Cost)
-		cost := sample.Cost
-		if cost < 0 {
-			cost = 0
-			break
-		}
-		if cost < 1e-9 {
+		meta, classes, _ := process(sample)
+		_, metrics := EvaluateClusters(meta, classes, len(sets[:Size]))
+		PrintMetrics(metrics)
+		if budget.Stop(sample.Cost, false) {
 			break
 		}
 	}
+	fmt.Println("stopped", budget.Reason)
 
 	clustersCount := len(sets[:Size])
 	meta, classes, params := process(sample)
-	clusters, _, err := kmeans.Kmeans(1, meta, clustersCount, kmeans.SquaredEuclideanDistance, -1)
-	if err != nil {
-		panic(err)
-	}
+	clusters, metrics := EvaluateClusters(meta, classes, clustersCount)
 	for i, v := range clusters {
 		fmt.Printf("%3d %3d %d\n", i, classes[i], v)
 	}
+	if *FlagExport != "" {
+		labels := NewLabels(sets, pairs)
+		rawData, _ := EmbedInputs(params, pairs)
+		Export(*FlagExport+"_embeddings", labels, Float64s(rawData))
+		Export(*FlagExport+"_meta", labels, meta)
+	}
 
 	var values plotter.Values
 	for _, param := range params {
@@ -228,118 +221,20 @@ func Encdec() {
 		panic(err)
 	}
 
-	ab, ba := make([][]float64, clustersCount), make([][]float64, clustersCount)
-	for i := range ab {
-		ab[i] = make([]float64, clustersCount)
-		ba[i] = make([]float64, clustersCount)
-	}
-	for i := range clusters {
-		a := int(classes[i])
-		b := clusters[i]
-		ab[a][b]++
-		ba[b][a]++
-	}
-	entropy := 0.0
-	for i := 0; i < clustersCount; i++ {
-		entropy += (1.0 / float64(clustersCount)) * math.Log(1.0/float64(clustersCount))
-	}
-	fmt.Println(-entropy, -(1.0/float64(clustersCount))*math.Log(1.0/float64(clustersCount)))
-	sumAB := 0.0
-	for i := range ab {
-		entropy := 0.0
-		for _, value := range ab[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
-		}
-		entropy = -entropy
-		fmt.Println("ab", i, entropy)
-		sumAB += entropy
-	}
-	sumBA := 0.0
-	for i := range ba {
-		entropy := 0.0
-		for _, value := range ba[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
-		}
-		entropy = -entropy
-		fmt.Println("ba", i, entropy)
-		sumBA += entropy
-	}
-	fmt.Println("sumAB", sumAB)
-	fmt.Println("sumBA", sumBA)
+	PrintMetrics(metrics)
 
-	outputs := []matrix.Matrix{}
-	for _, pair := range pairs {
-		output := matrix.NewZeroMatrix(Output, 1)
-		for _, p := range pair.Input.I {
-			input := matrix.NewZeroMatrix(Input, 1)
-			input.Data[p.C] = 1
-			input.Data[10+p.X] = 1
-			input.Data[10+30+p.Y] = 1
-			in := matrix.NewMatrix(Input+Output, 1)
-			in.Data = append(in.Data, input.Data...)
-			in.Data = append(in.Data, output.Data...)
-			output = params[2].MulT(params[0].MulT(in).Add(params[1]).Everett()).Add(params[3]).Sigmoid()
-		}
-		data := matrix.NewMatrix(Output, 1)
-		data.Data = append(data.Data, output.Data...)
-		outputs = append(outputs, data)
-	}
+	codes, _ := EmbedInputs(params, pairs)
 	processDecoder := func(sample matrix.Sample) (float64, []matrix.Matrix) {
-		x1 := sample.Vars[0][0].Sample()
-		y1 := sample.Vars[0][1].Sample()
-		z1 := sample.Vars[0][2].Sample()
-		w1 := x1.Add(y1.H(z1))
-
-		x2 := sample.Vars[1][0].Sample()
-		y2 := sample.Vars[1][1].Sample()
-		z2 := sample.Vars[1][2].Sample()
-		b1 := x2.Add(y2.H(z2))
-
-		x3 := sample.Vars[2][0].Sample()
-		y3 := sample.Vars[2][1].Sample()
-		z3 := sample.Vars[2][2].Sample()
-		w2 := x3.Add(y3.H(z3))
-
-		x4 := sample.Vars[3][0].Sample()
-		y4 := sample.Vars[3][1].Sample()
-		z4 := sample.Vars[3][2].Sample()
-		b2 := x4.Add(y4.H(z4))
-		params := []matrix.Matrix{w1, b1, w2, b2}
+		params := DecoderParams(sample)
 
 		cost := 0.0
 		for k, pair := range pairs {
-			output := matrix.NewZeroMatrix(Input+Output, 1)
-			copy(output.Data[Input:], outputs[k].Data)
-			loss, count := 0.0, 0.0
-			for i, p := range pair.Output.I {
-				input := matrix.NewZeroMatrix(Input, 1)
-				input.Data[p.C] = 1
-				input.Data[10+p.X] = 1
-				input.Data[10+30+p.Y] = 1
-				in := matrix.NewMatrix(Output, 1)
-				in.Data = append(in.Data, output.Data[Input:]...)
-				if i > 0 {
-					in = in.Sigmoid()
-				}
-				output = w2.MulT(w1.MulT(in).Add(b1).Everett()).Add(b2)
-				for k := range output.Data[:Input] {
-					diff := float64(input.Data[k]) - float64(output.Data[k])
-					loss += diff * diff
-					count++
-				}
-			}
-			cost += loss / count
+			cost += DecodeLoss(params, codes[k], pair.Output)
 		}
 		cost /= float64(Size)
 		return cost, params
 	}
-	optimizerDecoder := matrix.NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
+	optimizerDecoder := NewOptimizer(&rng, 4, .1, 4, func(samples []matrix.Sample, x ...matrix.Matrix) {
 		done := make(chan bool, 8)
 		sample := func(s *matrix.Sample) {
 			loss, _ := processDecoder(*s)
@@ -368,18 +263,41 @@ func Encdec() {
 		fmt.Printf("\n")
 	}, matrix.NewCoord(Output, Width), matrix.NewCoord(Width, 1),
 		matrix.NewCoord(2*Width, Input+Output), matrix.NewCoord(Input+Output, 1))
+	budgetDecoder := NewBudget(128)
 	var sample1 matrix.Sample
-	for i := 0; i < 128; i++ {
+	for i := 0; budgetDecoder.Next(i); i++ {
 		sample1 = optimizerDecoder.Iterate()
 		fmt.Println(i, sample1.Cost)
-		cost := sample.Cost
-		if cost < 0 {
-			cost = 0
+		if budgetDecoder.Stop(sample1.Cost, false) {
 			break
 		}
-		if cost < 1e-9 {
-			break
+	}
+	fmt.Println("stopped", budgetDecoder.Reason)
+
+	decoder := DecoderParams(sample1)
+	exact, total := 0, 0
+	for s, set := range sets[:Size] {
+		train := make([]Pair, 0, 8)
+		for _, t := range set.Train {
+			train = append(train, NewPair(s, t))
 		}
+		for t, test := range set.Test {
+			pair := Pair{
+				Class: s,
+				Input: Boustrophedon(test.Input),
+			}
+			w, h := PredictSize(train, pair.Input)
+			grid := Generate(decoder, EncodeInput(params, pair), w, h)
+			accuracy, ok := test.Output.Score(grid)
+			fmt.Println(set.Name, t, "accuracy", accuracy, "exact", ok)
+			if ok {
+				exact++
+			}
+			total++
+		}
+	}
+	fmt.Println("exact", exact, "of", total)
+	if err := SaveParams(*FlagDecoder, decoder); err != nil {
+		panic(err)
 	}
-	_ = sample1
 }
@@ -0,0 +1,144 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Certainty is the mean softmax probability of the colors of the cells of the candidate in [0, 1].
+// Symbolic candidates without cell confidences are certain, which is the certainty of a neural
+// candidate that puts all of the probability on the color of each cell
+func (c Candidate) Certainty() float64 {
+	if c.Confidence == nil {
+		return 1
+	}
+	sum, count := 0.0, 0.0
+	for _, row := range c.Confidence {
+		for _, value := range row {
+			sum += float64(value)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / count
+}
+
+// Combine merges the candidates with the same grid and returns up to two submission
+// attempts ranked by the summed train pair consistency and certainty of their solvers
+func Combine(candidates []Candidate) []Candidate {
+	merged := make([]Candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		score := candidate.Rate + candidate.Certainty()
+		found := false
+		for i := range merged {
+			if Equal(merged[i].Grid, candidate.Grid) {
+				merged[i].Score += score
+				if candidate.Rate > merged[i].Rate {
+					merged[i].Rate = candidate.Rate
+				}
+				if !strings.Contains(merged[i].Solver, candidate.Solver) {
+					merged[i].Solver += "," + candidate.Solver
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			candidate.Score = score
+			merged = append(merged, candidate)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+	if len(merged) > 2 {
+		merged = merged[:2]
+	}
+	return merged
+}
+
+// Ensemble is the ensemble mode
+func Ensemble() {
+	sets := Load()
+	solvers := make(map[string]bool)
+	for _, solver := range strings.Split(*FlagSolvers, ",") {
+		solvers[strings.TrimSpace(solver)] = true
+	}
+	predictors := []struct {
+		Name      string
+		Predictor Predictor
+	}{
+		{"ac", Predict},
+		{"sa", PredictSA},
+	}
+	solved, total := 0, 0
+	for s := 0; s < *FlagSets; s++ {
+		set := sets[s]
+		rates := make(map[string][]float64)
+		for _, p := range predictors {
+			if !solvers[p.Name] {
+				continue
+			}
+			rates[p.Name] = make([]float64, *FlagCandidates)
+			for i := range rates[p.Name] {
+				rates[p.Name][i] = Validate(sets, s, p.Predictor, uint32(i+1))
+			}
+		}
+		var programs []Program
+		rate := 0.0
+		if solvers["dsl"] {
+			programs = Search(set.Train, *FlagDepth, *FlagCandidates)
+			rate = ValidateDSL(set.Train, *FlagDepth)
+		}
+		for t, test := range set.Test {
+			candidates := make([]Candidate, 0, 8)
+			for _, p := range predictors {
+				if !solvers[p.Name] {
+					continue
+				}
+				for i, rate := range rates[p.Name] {
+					seed := uint32(i + 1)
+					prediction := p.Predictor(Set{Test: set.Test[t : t+1], Train: set.Train}, seed)[0]
+					candidates = append(candidates, Candidate{
+						Solver:     p.Name,
+						Seed:       seed,
+						Rate:       rate,
+						Cost:       prediction.Cost,
+						Grid:       prediction.Grid,
+						Confidence: prediction.Confidence,
+					})
+				}
+			}
+			for _, program := range programs {
+				grid, ok := program.Apply(test.Input)
+				if !ok {
+					continue
+				}
+				candidates = append(candidates, Candidate{
+					Solver: "dsl",
+					Rate:   rate,
+					Grid:   grid,
+				})
+			}
+			attempts := Combine(candidates)
+			correct := false
+			for i, attempt := range attempts {
+				_, exact := test.Output.Score(attempt.Grid)
+				fmt.Println("set", s, "test", t, "attempt", i, attempt.Solver, "score", attempt.Score, "exact", exact)
+				correct = correct || exact
+			}
+			if correct {
+				solved++
+			}
+			total++
+		}
+	}
+	fmt.Println("solved", solved, "of", total)
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Label is the label of an exported embedding
+type Label struct {
+	Task  string
+	Class int
+	Pair  int
+}
+
+// NewLabels creates the labels of the pairs of the sets
+func NewLabels(sets []Set, pairs []Pair) []Label {
+	labels, counts := make([]Label, len(pairs)), make(map[int]int)
+	for i, pair := range pairs {
+		labels[i] = Label{
+			Task:  sets[pair.Class].Name,
+			Class: pair.Class,
+			Pair:  counts[pair.Class],
+		}
+		counts[pair.Class]++
+	}
+	return labels
+}
+
+// WriteCSV writes the labeled rows to a csv file
+func WriteCSV(name string, labels []Label, rows [][]float64) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := csv.NewWriter(file)
+	header := []string{"task", "class", "pair"}
+	if len(rows) > 0 {
+		for i := range rows[0] {
+			header = append(header, fmt.Sprintf("x%d", i))
+		}
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		record := []string{labels[i].Task, strconv.Itoa(labels[i].Class), strconv.Itoa(labels[i].Pair)}
+		for _, value := range row {
+			record = append(record, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteNPY writes the rows to a numpy .npy file as a little endian float64 matrix
+func WriteNPY(name string, rows [][]float64) error {
+	cols := 0
+	if len(rows) > 0 {
+		cols = len(rows[0])
+	}
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", len(rows), cols)
+	// the magic, version and header length take 10 bytes and the header ends with a newline
+	padding := 64 - (10+len(header)+1)%64
+	header += strings.Repeat(" ", padding%64) + "\n"
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	writer.WriteString("\x93NUMPY")
+	writer.Write([]byte{1, 0})
+	binary.Write(writer, binary.LittleEndian, uint16(len(header)))
+	writer.WriteString(header)
+	buffer := make([]byte, 8)
+	for _, row := range rows {
+		for _, value := range row {
+			binary.LittleEndian.PutUint64(buffer, math.Float64bits(value))
+			writer.Write(buffer)
+		}
+	}
+	return writer.Flush()
+}
+
+// WriteTSV writes the vectors and metadata tsv files of the tensorboard projector
+func WriteTSV(prefix string, labels []Label, rows [][]float64) error {
+	vectors, err := os.Create(prefix + "_vectors.tsv")
+	if err != nil {
+		return err
+	}
+	defer vectors.Close()
+	writer := bufio.NewWriter(vectors)
+	for _, row := range rows {
+		for i, value := range row {
+			if i > 0 {
+				writer.WriteString("\t")
+			}
+			writer.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		writer.WriteString("\n")
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	metadata, err := os.Create(prefix + "_metadata.tsv")
+	if err != nil {
+		return err
+	}
+	defer metadata.Close()
+	writer = bufio.NewWriter(metadata)
+	writer.WriteString("task\tclass\tpair\n")
+	for _, label := range labels {
+		fmt.Fprintf(writer, "%s\t%d\t%d\n", label.Task, label.Class, label.Pair)
+	}
+	return writer.Flush()
+}
+
+// Float64s converts rows of float32 values to float64 for exporting
+func Float64s(rows [][]float32) [][]float64 {
+	converted := make([][]float64, len(rows))
+	for i, row := range rows {
+		converted[i] = make([]float64, len(row))
+		for j, value := range row {
+			converted[i][j] = float64(value)
+		}
+	}
+	return converted
+}
+
+// Export writes the labeled rows to csv and npy files, and tsv files if FlagTSV is set
+func Export(prefix string, labels []Label, rows [][]float64) {
+	if err := WriteCSV(prefix+".csv", labels, rows); err != nil {
+		panic(err)
+	}
+	if err := WriteNPY(prefix+".npy", rows); err != nil {
+		panic(err)
+	}
+	if *FlagTSV {
+		if err := WriteTSV(prefix, labels, rows); err != nil {
+			panic(err)
+		}
+	}
+	fmt.Println("exported", prefix)
+}
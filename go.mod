@@ -2,6 +2,11 @@ module github.com/pointlander/frozenstar
 
 go 1.22.4
 
+require (
+	github.com/pointlander/matrix v0.0.0-20240607004922-7137a4bd2ebe
+	gonum.org/v1/plot v0.14.0
+)
+
 require (
 	git.sr.ht/~sbinet/gg v0.5.0 // indirect
 	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
@@ -11,8 +16,6 @@ require (
 	github.com/go-pdf/fpdf v0.8.0 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/pointlander/matrix v0.0.0-20240607004922-7137a4bd2ebe // indirect
 	golang.org/x/image v0.11.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
-	gonum.org/v1/plot v0.14.0 // indirect
 )
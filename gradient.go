@@ -0,0 +1,122 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/pointlander/frozenstar/autodiff"
+	"github.com/pointlander/matrix"
+)
+
+// Loss computes the loss of the variables on a tape, returning true if the task is solved
+type Loss func(t *autodiff.Tape, vars []*autodiff.Value) (*autodiff.Value, bool)
+
+// Gradient trains parameters of the given shapes with adam, calling iteration
+// with the deterministic sample of the parameters after each step
+func Gradient(seed uint32, loss Loss, iteration func(i int, sample matrix.Sample), shapes ...matrix.Matrix) matrix.Sample {
+	rng := matrix.Rand(seed)
+	space := NewSpace(&rng, len(shapes), nil, shapes...)
+	theta := space.Init()
+	params, index := make([]matrix.Matrix, len(shapes)), 0
+	for i, shape := range shapes {
+		size := shape.Cols * shape.Rows
+		params[i] = matrix.NewMatrix(shape.Cols, shape.Rows, theta[index:index+size]...)
+		index += size
+	}
+	adam := autodiff.NewAdam(*FlagRate)
+	budget := NewBudget(256)
+	var sample matrix.Sample
+	for i := 0; budget.Next(i); i++ {
+		t := autodiff.NewTape()
+		vars := make([]*autodiff.Value, len(params))
+		for j, param := range params {
+			vars[j] = t.Var(param)
+		}
+		l, solved := loss(t, vars)
+		t.Backward(l)
+		theta = make([]float32, 0, space.Size())
+		for _, param := range params {
+			theta = append(theta, param.Data...)
+		}
+		sample = space.Sample(theta)
+		sample.Cost = float64(l.X.Data[0])
+		fmt.Println(i, sample.Cost)
+		if iteration != nil {
+			iteration(i, sample)
+		}
+		if budget.Stop(sample.Cost, solved) {
+			break
+		}
+		adam.Step(vars...)
+	}
+	fmt.Println("stopped", budget.Reason)
+	return sample
+}
+
+// SoftTokens is the tokens of an optimization with the target rows filled with the soft
+// target tokens of the rows of params in the given encoding, instead of their argmax
+func SoftTokens(t *autodiff.Tape, encoding Encoding, tokens Tokens, params *autodiff.Value) *autodiff.Value {
+	width := encoding.Width
+	prefix := matrix.NewMatrix(width, tokens.Offset, tokens.Opt.Data[:width*tokens.Offset]...)
+	return t.Concat(t.Var(prefix), encoding.Soft(t, params))
+}
+
+// TrainSAGradient trains the self attention model of TrainSATokens with gradient descent on its self entropy
+func TrainSAGradient(seed uint32, encoding Encoding, source []Tokens, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	width := encoding.Width
+	loss := func(t *autodiff.Tape, vars []*autodiff.Value) (*autodiff.Value, bool) {
+		w1, q, k, v, w2, b2 := vars[0], vars[1], vars[2], vars[3], vars[4], vars[5]
+		var sum *autodiff.Value
+		for _, opt := range source {
+			output := t.Sigmoid(t.Add(t.MulT(w2, SoftTokens(t, encoding, opt, w1)), b2))
+			entropy := t.Sum(t.SelfEntropy(t.MulT(q, output), t.MulT(k, output), t.MulT(v, output)))
+			if sum == nil {
+				sum = entropy
+			} else {
+				sum = t.Add(sum, entropy)
+			}
+		}
+		return sum, false
+	}
+	return Gradient(seed, loss, iteration, matrix.NewCoord(width, source[0].Size),
+		matrix.NewCoord(width, 2*width), matrix.NewCoord(width, 2*width), matrix.NewCoord(width, 2*width),
+		matrix.NewCoord(width, width), matrix.NewCoord(width, 1))
+}
+
+// TrainACGradient trains the autocoder of TrainACTokens with gradient descent on its reconstruction error
+func TrainACGradient(seed uint32, encoding Encoding, sets [][]Tokens, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	width := encoding.Width
+	loss := func(t *autodiff.Tape, vars []*autodiff.Value) (*autodiff.Value, bool) {
+		q, k, v, w1, b1 := vars[0], vars[1], vars[2], vars[3], vars[4]
+		var sum *autodiff.Value
+		solved := true
+		for o, opts := range sets {
+			for _, opt := range opts {
+				x := SoftTokens(t, encoding, opt, vars[5+o])
+				output := t.Sigmoid(t.Add(t.MulT(w1, x), b1))
+				out := t.SelfAttention(t.MulT(q, output), t.MulT(k, output), t.MulT(v, output))
+				mse := t.Scale(t.MSE(out, x), 1/float32(len(opts)))
+				if sum == nil {
+					sum = mse
+				} else {
+					sum = t.Add(sum, mse)
+				}
+				if !Reconstructed(Trace{Opt: opt, Reconstruction: out.X}) {
+					solved = false
+				}
+			}
+		}
+		return sum, solved
+	}
+	shapes := []matrix.Matrix{
+		matrix.NewCoord(8*width, width), matrix.NewCoord(8*width, width), matrix.NewCoord(8*width, width),
+		matrix.NewCoord(width, 8*width), matrix.NewCoord(8*width, 1),
+	}
+	for _, opt := range sets {
+		shapes = append(shapes, matrix.NewCoord(width, opt[0].Size))
+	}
+	return Gradient(seed, loss, iteration, shapes...)
+}
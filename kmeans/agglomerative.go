@@ -0,0 +1,108 @@
+package kmeans
+
+/*
+This module provides agglomerative hierarchical clustering, which starts with
+every observation in its own cluster and merges the two nearest clusters until
+there are K clusters. The distance between clusters is given by the linkage:
+single (nearest observations), complete (farthest observations) or average.
+*/
+
+import (
+	"fmt"
+	"math"
+)
+
+// Linkage is the distance between two clusters
+type Linkage int
+
+const (
+	// SingleLinkage is the distance of the nearest observations of the clusters
+	SingleLinkage Linkage = iota
+	// CompleteLinkage is the distance of the farthest observations of the clusters
+	CompleteLinkage
+	// AverageLinkage is the average distance of the observations of the clusters
+	AverageLinkage
+)
+
+// ParseLinkage parses the name of a linkage
+func ParseLinkage(name string) (Linkage, error) {
+	switch name {
+	case "single":
+		return SingleLinkage, nil
+	case "complete":
+		return CompleteLinkage, nil
+	case "average":
+		return AverageLinkage, nil
+	}
+	return 0, fmt.Errorf("unknown linkage %s, expected one of single, complete, average", name)
+}
+
+// Agglomerative is agglomerative hierarchical clustering
+type Agglomerative struct {
+	K        int
+	Linkage  Linkage
+	Distance DistanceFunction
+}
+
+// Cluster merges the nearest clusters of the observations until there are K clusters
+func (a Agglomerative) Cluster(rawData [][]float64) ([]int, error) {
+	if err := validate(rawData, a.K); err != nil {
+		return nil, err
+	}
+	distances, err := pairwise(rawData, a.Distance)
+	if err != nil {
+		return nil, err
+	}
+	// The cluster of each observation is the index of its root observation
+	parents, sizes, active := make([]int, len(rawData)), make([]int, len(rawData)), make([]bool, len(rawData))
+	for ii := range parents {
+		parents[ii], sizes[ii], active[ii] = ii, 1, true
+	}
+	for clusters := len(rawData); clusters > a.K; clusters-- {
+		first, second, nearest := -1, -1, math.MaxFloat64
+		for ii := range distances {
+			if !active[ii] {
+				continue
+			}
+			for jj := ii + 1; jj < len(distances); jj++ {
+				if active[jj] && (first < 0 || distances[ii][jj] < nearest) {
+					first, second, nearest = ii, jj, distances[ii][jj]
+				}
+			}
+		}
+		// Lance-Williams update of the distances to the merged cluster
+		for kk := range distances {
+			if !active[kk] || kk == first || kk == second {
+				continue
+			}
+			var distance float64
+			switch a.Linkage {
+			case SingleLinkage:
+				distance = math.Min(distances[first][kk], distances[second][kk])
+			case CompleteLinkage:
+				distance = math.Max(distances[first][kk], distances[second][kk])
+			case AverageLinkage:
+				distance = (float64(sizes[first])*distances[first][kk] + float64(sizes[second])*distances[second][kk]) /
+					float64(sizes[first]+sizes[second])
+			default:
+				return nil, fmt.Errorf("unknown linkage %d", a.Linkage)
+			}
+			distances[first][kk], distances[kk][first] = distance, distance
+		}
+		sizes[first] += sizes[second]
+		active[second] = false
+		for ii := range parents {
+			if parents[ii] == second {
+				parents[ii] = first
+			}
+		}
+	}
+	labels, index := make([]int, len(rawData)), make(map[int]int)
+	for ii, parent := range parents {
+		if _, ok := index[parent]; !ok {
+			index[parent] = len(index)
+		}
+		labels[ii] = index[parent]
+	}
+	return labels, nil
+}
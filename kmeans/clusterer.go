@@ -0,0 +1,56 @@
+package kmeans
+
+/*
+This module provides a common interface for the clustering algorithms of the
+package, so that callers can switch between them.
+*/
+
+import (
+	"fmt"
+	"math"
+)
+
+// Clusterer is a clustering algorithm which labels the observations with their clusters
+type Clusterer interface {
+	Cluster(rawData [][]float64) ([]int, error)
+}
+
+// Pairwise distances between the observations
+func pairwise(rawData [][]float64, distanceFunction DistanceFunction) ([][]float64, error) {
+	distances := make([][]float64, len(rawData))
+	for ii := range distances {
+		distances[ii] = make([]float64, len(rawData))
+	}
+	for ii := range rawData {
+		for jj := ii + 1; jj < len(rawData); jj++ {
+			distance, err := distanceFunction(rawData[ii], rawData[jj])
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(distance) {
+				return nil, fmt.Errorf("the distance between observations %d and %d is not a number", ii, jj)
+			}
+			distances[ii][jj], distances[jj][ii] = distance, distance
+		}
+	}
+	return distances, nil
+}
+
+// KMeans is Lloyd's k-means with k-means++ seeds
+type KMeans struct {
+	Seed      int64
+	K         int
+	Distance  DistanceFunction
+	Threshold int
+	// Workers is the number of goroutines of the assignment and update steps, or all of the cpus if not positive
+	Workers int
+}
+
+// Cluster clusters the observations with k-means
+func (k KMeans) Cluster(rawData [][]float64) ([]int, error) {
+	result, err := FitWorkers(k.Seed, rawData, k.K, k.Distance, k.Threshold, k.Workers)
+	if err != nil {
+		return nil, err
+	}
+	return result.Labels, nil
+}
@@ -0,0 +1,158 @@
+package kmeans
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// separated generates n observations of 2 dimensions around k centers 20 apart,
+// returning the observations and the center of each observation
+func separated(seed int64, n, k int) ([][]float64, []int) {
+	rng := rand.New(rand.NewSource(seed))
+	data, classes := make([][]float64, n), make([]int, n)
+	for ii := range data {
+		classes[ii] = ii % k
+		data[ii] = []float64{20*float64(classes[ii]) + rng.NormFloat64()/2, 10*float64(classes[ii]%2) + rng.NormFloat64()/2}
+	}
+	return data, classes
+}
+
+func TestClusterers(t *testing.T) {
+	data, classes := separated(1, 90, 3)
+	clusterers := map[string]Clusterer{
+		"kmeans":    KMeans{Seed: 1, K: 3, Distance: SquaredEuclideanDistance, Threshold: 100, Workers: 2},
+		"kmedoids":  KMedoids{K: 3, Distance: EuclideanDistance},
+		"minibatch": MiniBatch{Seed: 1, K: 3, Distance: SquaredEuclideanDistance, Batch: 30, Iterations: 50},
+		"dbscan":    DBSCAN{Eps: 3, MinPts: 4, Distance: EuclideanDistance},
+		"single":    Agglomerative{K: 3, Linkage: SingleLinkage, Distance: EuclideanDistance},
+		"complete":  Agglomerative{K: 3, Linkage: CompleteLinkage, Distance: EuclideanDistance},
+		"average":   Agglomerative{K: 3, Linkage: AverageLinkage, Distance: EuclideanDistance},
+	}
+	for name, clusterer := range clusterers {
+		labels, err := clusterer.Cluster(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		metrics, err := Evaluate(classes, labels)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equal(metrics.ARI, 1) {
+			t.Errorf("%s: ari %f", name, metrics.ARI)
+		}
+	}
+}
+
+func TestKMedoids(t *testing.T) {
+	data := [][]float64{{0}, {1}, {2}, {10}, {11}, {12}, {13}}
+	medoids, err := KMedoids{K: 2, Distance: EuclideanDistance}.Medoids(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The medoid of 10, 11, 12, 13 is 11 or 12
+	if len(medoids) != 2 || !(medoids[0] == 1 || medoids[1] == 1) ||
+		!(medoids[0] == 4 || medoids[1] == 4 || medoids[0] == 5 || medoids[1] == 5) {
+		t.Errorf("medoids %v", medoids)
+	}
+	// One swap is enough to move a medoid
+	if _, err := (KMedoids{K: 2, Distance: EuclideanDistance, Iterations: 1}).Medoids(data); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDBSCANNoise(t *testing.T) {
+	data, _ := separated(1, 60, 2)
+	data = append(data, []float64{100, 100})
+	labels, err := DBSCAN{Eps: 3, MinPts: 4, Distance: EuclideanDistance}.Cluster(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels[len(labels)-1] != Noise {
+		t.Errorf("the outlier is in cluster %d", labels[len(labels)-1])
+	}
+	clusters := map[int]bool{}
+	for _, label := range labels[:len(labels)-1] {
+		clusters[label] = true
+	}
+	if len(clusters) != 2 || clusters[Noise] {
+		t.Errorf("clusters %v", clusters)
+	}
+	for _, d := range []DBSCAN{
+		{Eps: 0, MinPts: 4, Distance: EuclideanDistance},
+		{Eps: 1, MinPts: 0, Distance: EuclideanDistance},
+	} {
+		if _, err := d.Cluster(data); err == nil {
+			t.Errorf("eps %f and minpts %d: expected an error", d.Eps, d.MinPts)
+		}
+	}
+}
+
+func TestAgglomerativeLinkage(t *testing.T) {
+	// A chain of close observations and a compact pair: single linkage follows the chain
+	data := [][]float64{{0}, {2}, {4}, {6}, {8}, {20}, {21}}
+	labels, err := Agglomerative{K: 2, Linkage: SingleLinkage, Distance: EuclideanDistance}.Cluster(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, label := range labels {
+		if expected := labels[0]; ii >= 5 {
+			expected = labels[6]
+			if label != expected || label == labels[0] {
+				t.Errorf("labels %v", labels)
+			}
+		} else if label != expected {
+			t.Errorf("labels %v", labels)
+		}
+	}
+	for _, name := range []string{"single", "complete", "average"} {
+		if _, err := ParseLinkage(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := ParseLinkage("ward"); err == nil {
+		t.Error("expected an error for an unknown linkage")
+	}
+}
+
+func TestNotANumber(t *testing.T) {
+	data, _ := separated(1, 12, 3)
+	nan := func(firstVector, secondVector []float64) (float64, error) {
+		return math.NaN(), nil
+	}
+	clusterers := map[string]Clusterer{
+		"kmedoids":      KMedoids{K: 3, Distance: nan},
+		"dbscan":        DBSCAN{Eps: 3, MinPts: 4, Distance: nan},
+		"agglomerative": Agglomerative{K: 3, Linkage: AverageLinkage, Distance: nan},
+	}
+	for name, clusterer := range clusterers {
+		if _, err := clusterer.Cluster(data); err == nil {
+			t.Errorf("%s: expected an error for a distance that is not a number", name)
+		}
+	}
+}
+
+func TestInfiniteDistances(t *testing.T) {
+	data, _ := separated(1, 12, 3)
+	inf := func(firstVector, secondVector []float64) (float64, error) {
+		return math.Inf(1), nil
+	}
+	clusterers := map[string]Clusterer{
+		"kmedoids":      KMedoids{K: 3, Distance: inf},
+		"agglomerative": Agglomerative{K: 3, Linkage: AverageLinkage, Distance: inf},
+	}
+	for name, clusterer := range clusterers {
+		labels, err := clusterer.Cluster(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		for _, label := range labels {
+			if label < 0 || label >= 3 {
+				t.Errorf("%s: labels %v", name, labels)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package kmeans
+
+/*
+This module provides density-based spatial clustering of applications with
+noise (DBSCAN). The number of clusters is not given, clusters grow from core
+observations with at least MinPts neighbors within Eps, and observations that
+are not reachable from a core observation are labeled as noise.
+*/
+
+import (
+	"errors"
+)
+
+// Noise is the label of the observations that are not in a cluster
+const Noise = -1
+
+// DBSCAN is density-based spatial clustering of applications with noise
+type DBSCAN struct {
+	Eps      float64
+	MinPts   int
+	Distance DistanceFunction
+}
+
+// Cluster clusters the observations, labeling noise with Noise
+func (d DBSCAN) Cluster(rawData [][]float64) ([]int, error) {
+	if err := validateData(rawData); err != nil {
+		return nil, err
+	}
+	if d.Eps <= 0 {
+		return nil, errors.New("eps must be positive")
+	}
+	if d.MinPts < 1 {
+		return nil, errors.New("minpts must be at least one")
+	}
+	distances, err := pairwise(rawData, d.Distance)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := func(ii int) []int {
+		result := make([]int, 0, 8)
+		for jj, distance := range distances[ii] {
+			if distance <= d.Eps {
+				result = append(result, jj)
+			}
+		}
+		return result
+	}
+
+	const unvisited = -2
+	labels := make([]int, len(rawData))
+	for ii := range labels {
+		labels[ii] = unvisited
+	}
+	cluster := 0
+	for ii := range rawData {
+		if labels[ii] != unvisited {
+			continue
+		}
+		seeds := neighbors(ii)
+		if len(seeds) < d.MinPts {
+			labels[ii] = Noise
+			continue
+		}
+		labels[ii] = cluster
+		for len(seeds) > 0 {
+			jj := seeds[0]
+			seeds = seeds[1:]
+			if labels[jj] == Noise {
+				labels[jj] = cluster
+			}
+			if labels[jj] != unvisited {
+				continue
+			}
+			labels[jj] = cluster
+			if next := neighbors(jj); len(next) >= d.MinPts {
+				seeds = append(seeds, next...)
+			}
+		}
+		cluster++
+	}
+	return labels, nil
+}
@@ -13,9 +13,14 @@ when p goes infinity, it becomes ChebyshevDistance.
 
 Since the ManhattanDistance and EuclideanDistance are very frequently used, they are
 implemented separately.
+
+Distances with parameters are created by constructors which close over the
+parameters and return a DistanceFunction, so that they can be passed to Kmeans.
 */
 
 import (
+	"errors"
+	"fmt"
 	"math"
 )
 
@@ -98,13 +103,197 @@ func BrayCurtisDistance(firstVector, secondVector []float64) (float64, error) {
 		numerator += math.Abs(firstVector[ii] - secondVector[ii])
 		denominator += math.Abs(firstVector[ii] + secondVector[ii])
 	}
+	if numerator == 0 {
+		// Equal vectors, including zero vectors, are at distance zero
+		return 0, nil
+	}
 	return numerator / denominator, nil
 }
 
 func CanberraDistance(firstVector, secondVector []float64) (float64, error) {
 	distance := 0.
 	for ii := range firstVector {
-		distance += (math.Abs(firstVector[ii]-secondVector[ii]) / (math.Abs(firstVector[ii]) + math.Abs(secondVector[ii])))
+		denominator := math.Abs(firstVector[ii]) + math.Abs(secondVector[ii])
+		if denominator == 0 {
+			// Coordinates which are both zero are equal, so they don't contribute
+			continue
+		}
+		distance += math.Abs(firstVector[ii]-secondVector[ii]) / denominator
+	}
+	return distance, nil
+}
+
+// Check that two vectors have the same number of dimensions
+func dimensions(firstVector, secondVector []float64) error {
+	if len(firstVector) != len(secondVector) {
+		return fmt.Errorf("%d != %d dimensions", len(firstVector), len(secondVector))
+	}
+	return nil
+}
+
+// p-norm distance function (l_p distance), given p >= 1
+func Minkowski(p float64) DistanceFunction {
+	return func(firstVector, secondVector []float64) (float64, error) {
+		if err := dimensions(firstVector, secondVector); err != nil {
+			return 0, err
+		}
+		return MinkowskiDistance(firstVector, secondVector, p)
+	}
+}
+
+// p-norm distance function with weights (weighted l_p distance), given p >= 1
+func WeightedMinkowski(weightVector []float64, p float64) DistanceFunction {
+	return func(firstVector, secondVector []float64) (float64, error) {
+		if err := dimensions(firstVector, secondVector); err != nil {
+			return 0, err
+		}
+		if err := dimensions(firstVector, weightVector); err != nil {
+			return 0, err
+		}
+		return WeightedMinkowskiDistance(firstVector, secondVector, weightVector, p)
+	}
+}
+
+// One minus the cosine of the angle between the vectors
+func CosineDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	dot, first, second := 0., 0., 0.
+	for ii := range firstVector {
+		dot += firstVector[ii] * secondVector[ii]
+		first += firstVector[ii] * firstVector[ii]
+		second += secondVector[ii] * secondVector[ii]
+	}
+	if first == 0 || second == 0 {
+		return 0, errors.New("the cosine distance is not defined for a zero vector")
+	}
+	return 1 - dot/math.Sqrt(first*second), nil
+}
+
+// One minus the Pearson correlation of the vectors
+func CorrelationDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	firstMean, secondMean := 0., 0.
+	for ii := range firstVector {
+		firstMean += firstVector[ii]
+		secondMean += secondVector[ii]
+	}
+	firstMean /= float64(len(firstVector))
+	secondMean /= float64(len(secondVector))
+	centeredFirst, centeredSecond := make([]float64, len(firstVector)), make([]float64, len(secondVector))
+	for ii := range firstVector {
+		centeredFirst[ii] = firstVector[ii] - firstMean
+		centeredSecond[ii] = secondVector[ii] - secondMean
+	}
+	distance, err := CosineDistance(centeredFirst, centeredSecond)
+	if err != nil {
+		return 0, errors.New("the correlation distance is not defined for a constant vector")
 	}
 	return distance, nil
 }
+
+// Square root of the Jensen-Shannon divergence of the vectors normalized to probability distributions
+func JensenShannonDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	firstSum, secondSum := 0., 0.
+	for ii := range firstVector {
+		if firstVector[ii] < 0 || secondVector[ii] < 0 {
+			return 0, errors.New("the jensen-shannon distance is not defined for negative values")
+		}
+		firstSum += firstVector[ii]
+		secondSum += secondVector[ii]
+	}
+	if firstSum == 0 || secondSum == 0 {
+		return 0, errors.New("the jensen-shannon distance is not defined for a zero vector")
+	}
+	divergence := 0.
+	for ii := range firstVector {
+		p, q := firstVector[ii]/firstSum, secondVector[ii]/secondSum
+		m := (p + q) / 2
+		if p > 0 {
+			divergence += p * math.Log(p/m) / 2
+		}
+		if q > 0 {
+			divergence += q * math.Log(q/m) / 2
+		}
+	}
+	return math.Sqrt(math.Max(divergence, 0)), nil
+}
+
+// Mahalanobis distance function with the covariance fitted to the observations
+func Mahalanobis(rawData [][]float64) (DistanceFunction, error) {
+	if err := validateData(rawData); err != nil {
+		return nil, err
+	}
+	if len(rawData) < 2 {
+		return nil, errors.New("there must be at least two observations to fit the covariance")
+	}
+	n := len(rawData[0])
+	mean := make(Observation, n)
+	for _, jj := range rawData {
+		mean.Add(jj)
+	}
+	mean.Mul(1 / float64(len(rawData)))
+	// Augment the sample covariance with the identity for Gauss-Jordan elimination
+	augmented := make([][]float64, n)
+	for ii := range augmented {
+		augmented[ii] = make([]float64, 2*n)
+		augmented[ii][n+ii] = 1
+	}
+	for _, jj := range rawData {
+		for ii := 0; ii < n; ii++ {
+			for kk := 0; kk < n; kk++ {
+				augmented[ii][kk] += (jj[ii] - mean[ii]) * (jj[kk] - mean[kk]) / float64(len(rawData)-1)
+			}
+		}
+	}
+	for ii := 0; ii < n; ii++ {
+		pivot := ii
+		for kk := ii + 1; kk < n; kk++ {
+			if math.Abs(augmented[kk][ii]) > math.Abs(augmented[pivot][ii]) {
+				pivot = kk
+			}
+		}
+		if math.Abs(augmented[pivot][ii]) < 1e-12 {
+			return nil, errors.New("the covariance of the observations is singular")
+		}
+		augmented[ii], augmented[pivot] = augmented[pivot], augmented[ii]
+		scale := augmented[ii][ii]
+		for kk := range augmented[ii] {
+			augmented[ii][kk] /= scale
+		}
+		for kk := 0; kk < n; kk++ {
+			if kk == ii || augmented[kk][ii] == 0 {
+				continue
+			}
+			factor := augmented[kk][ii]
+			for ll := range augmented[kk] {
+				augmented[kk][ll] -= factor * augmented[ii][ll]
+			}
+		}
+	}
+	inverse := make([][]float64, n)
+	for ii := range inverse {
+		inverse[ii] = augmented[ii][n:]
+	}
+	return func(firstVector, secondVector []float64) (float64, error) {
+		if err := dimensions(firstVector, secondVector); err != nil {
+			return 0, err
+		}
+		if err := dimensions(firstVector, mean); err != nil {
+			return 0, err
+		}
+		distance := 0.
+		for ii := range firstVector {
+			for kk := range firstVector {
+				distance += (firstVector[ii] - secondVector[ii]) * inverse[ii][kk] * (firstVector[kk] - secondVector[kk])
+			}
+		}
+		return math.Sqrt(math.Max(distance, 0)), nil
+	}, nil
+}
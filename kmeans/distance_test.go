@@ -0,0 +1,205 @@
+package kmeans
+
+import (
+	"math"
+	"testing"
+)
+
+// equal is true if the values are equal within floating point error
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDistances(t *testing.T) {
+	first, second := []float64{1, 2, 3, 5}, []float64{4, 0, 3, 5}
+	tests := []struct {
+		name     string
+		distance DistanceFunction
+		expected float64
+	}{
+		{"manhattan", ManhattanDistance, 5},
+		{"euclidean", EuclideanDistance, math.Sqrt(13)},
+		{"squared euclidean", SquaredEuclideanDistance, 13},
+		{"generic squared euclidean", SquaredEuclidean[float64], 13},
+		{"generic euclidean", Euclidean[float64], math.Sqrt(13)},
+		{"chebyshev", ChebyshevDistance, 3},
+		{"hamming", HammingDistance, 2},
+		{"bray-curtis", BrayCurtisDistance, 5. / 23},
+		{"canberra", CanberraDistance, 3./5 + 2./2},
+		{"minkowski p=1", func(a, b []float64) (float64, error) {
+			return MinkowskiDistance(a, b, 1)
+		}, 5},
+		{"minkowski p=2", func(a, b []float64) (float64, error) {
+			return MinkowskiDistance(a, b, 2)
+		}, math.Sqrt(13)},
+		{"weighted minkowski", func(a, b []float64) (float64, error) {
+			return WeightedMinkowskiDistance(a, b, []float64{2, 1, 1, 1}, 2)
+		}, math.Sqrt(22)},
+	}
+	for _, test := range tests {
+		distance, err := test.distance(first, second)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equal(distance, test.expected) {
+			t.Errorf("%s: %f != %f", test.name, distance, test.expected)
+		}
+		if self, _ := test.distance(first, first); self != 0 {
+			t.Errorf("%s: the distance of an observation to itself is %f", test.name, self)
+		}
+	}
+
+	norms := []struct {
+		p        float64
+		expected float64
+	}{
+		{1, 7},
+		{2, 5},
+		{3, math.Cbrt(91)},
+	}
+	for _, norm := range norms {
+		value, err := LPNorm([]float64{3, -4}, norm.p)
+		if err != nil || !equal(value, norm.expected) {
+			t.Errorf("l%f norm: %f != %f %v", norm.p, value, norm.expected, err)
+		}
+	}
+
+	float32s, err := SquaredEuclidean([]float32{1, 2}, []float32{4, 6})
+	if err != nil || float32s != 25 {
+		t.Errorf("float32 squared euclidean: %f != 25 %v", float32s, err)
+	}
+}
+
+func TestZeroCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		distance DistanceFunction
+		first    []float64
+		second   []float64
+		expected float64
+	}{
+		{"bray-curtis zero vectors", BrayCurtisDistance, []float64{0, 0}, []float64{0, 0}, 0},
+		{"canberra zero vectors", CanberraDistance, []float64{0, 0}, []float64{0, 0}, 0},
+		{"bray-curtis zero coordinate", BrayCurtisDistance, []float64{1, 0}, []float64{3, 0}, .5},
+		{"canberra zero coordinate", CanberraDistance, []float64{1, 0}, []float64{3, 0}, .5},
+	}
+	for _, test := range tests {
+		distance, err := test.distance(test.first, test.second)
+		if err != nil || !equal(distance, test.expected) {
+			t.Errorf("%s: %f != %f %v", test.name, distance, test.expected, err)
+		}
+	}
+}
+
+func TestParametricDistances(t *testing.T) {
+	s := math.Sqrt(1.5)
+	// The sample covariance of these observations is the identity
+	mahalanobis, err := Mahalanobis([][]float64{{s, 0}, {-s, 0}, {0, s}, {0, -s}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		distance DistanceFunction
+		first    []float64
+		second   []float64
+		expected float64
+	}{
+		{"minkowski p=1", Minkowski(1), []float64{1, 2}, []float64{4, 6}, 7},
+		{"minkowski p=2", Minkowski(2), []float64{1, 2}, []float64{4, 6}, 5},
+		{"minkowski p=3", Minkowski(3), []float64{0, 0}, []float64{1, 1}, math.Cbrt(2)},
+		{"weighted minkowski", WeightedMinkowski([]float64{1, 4}, 2), []float64{0, 0}, []float64{1, 1}, math.Sqrt(5)},
+		{"cosine orthogonal", CosineDistance, []float64{1, 0, 0}, []float64{0, 2, 0}, 1},
+		{"cosine parallel", CosineDistance, []float64{1, 2, 3}, []float64{2, 4, 6}, 0},
+		{"cosine opposite", CosineDistance, []float64{1, 2}, []float64{-1, -2}, 2},
+		{"cosine 45 degrees", CosineDistance, []float64{1, 1}, []float64{0, 1}, 1 - math.Sqrt2/2},
+		{"correlation negation", CorrelationDistance, []float64{1, 2, 3}, []float64{-1, -2, -3}, 2},
+		{"correlation linear", CorrelationDistance, []float64{1, 2, 3}, []float64{10, 20, 30}, 0},
+		{"correlation uncorrelated", CorrelationDistance, []float64{1, 2, 1, 2}, []float64{1, 1, 2, 2}, 1},
+		{"jensen-shannon disjoint", JensenShannonDistance, []float64{1, 0}, []float64{0, 1}, math.Sqrt(math.Ln2)},
+		{"jensen-shannon equal", JensenShannonDistance, []float64{1, 3}, []float64{2, 6}, 0},
+		{"jensen-shannon half", JensenShannonDistance, []float64{1, 1}, []float64{1, 0},
+			math.Sqrt((.5*math.Log(.5/.75) + .5*math.Log(.5/.25) + math.Log(1/.75)) / 2)},
+		{"mahalanobis identity", mahalanobis, []float64{1, 2}, []float64{4, 6}, 5},
+	}
+	for _, test := range tests {
+		distance, err := test.distance(test.first, test.second)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equal(distance, test.expected) {
+			t.Errorf("%s: %f != %f", test.name, distance, test.expected)
+		}
+	}
+}
+
+func TestMahalanobisEuclidean(t *testing.T) {
+	s := math.Sqrt(1.5)
+	mahalanobis, err := Mahalanobis([][]float64{{s, 0}, {-s, 0}, {0, s}, {0, -s}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2][]float64{{{0, 0}, {1, 1}}, {{-3, 2}, {5, 7}}, {{.5, .25}, {.5, .25}}} {
+		expected, _ := EuclideanDistance(pair[0], pair[1])
+		distance, err := mahalanobis(pair[0], pair[1])
+		if err != nil || !equal(distance, expected) {
+			t.Errorf("%v: %f != %f %v", pair, distance, expected, err)
+		}
+	}
+}
+
+func TestParametricDistanceErrors(t *testing.T) {
+	mahalanobis, err := Mahalanobis([][]float64{{1, 0}, {0, 1}, {2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		distance DistanceFunction
+		first    []float64
+		second   []float64
+	}{
+		{"minkowski dimensions", Minkowski(2), []float64{1, 2}, []float64{1}},
+		{"weighted minkowski weights", WeightedMinkowski([]float64{1}, 2), []float64{1, 2}, []float64{3, 4}},
+		{"cosine zero vector", CosineDistance, []float64{0, 0}, []float64{1, 2}},
+		{"cosine dimensions", CosineDistance, []float64{1, 2, 3}, []float64{1, 2}},
+		{"correlation constant vector", CorrelationDistance, []float64{3, 3, 3}, []float64{1, 2, 3}},
+		{"correlation dimensions", CorrelationDistance, []float64{1, 2}, []float64{1, 2, 3}},
+		{"jensen-shannon negative", JensenShannonDistance, []float64{1, -1}, []float64{1, 1}},
+		{"jensen-shannon zero vector", JensenShannonDistance, []float64{0, 0}, []float64{1, 1}},
+		{"jensen-shannon dimensions", JensenShannonDistance, []float64{1}, []float64{1, 1}},
+		{"mahalanobis dimensions", mahalanobis, []float64{1, 2, 3}, []float64{1, 2, 3}},
+	}
+	for _, test := range tests {
+		if _, err := test.distance(test.first, test.second); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	for _, data := range [][][]float64{
+		{{1, 1}, {2, 2}, {3, 3}},
+		{{1, 2}},
+		{},
+		{{1, 2}, {3}},
+	} {
+		if _, err := Mahalanobis(data); err == nil {
+			t.Errorf("mahalanobis of %v: expected an error", data)
+		}
+	}
+}
+
+func BenchmarkSquaredEuclideanDistance(b *testing.B) {
+	data := blobs(1, 2, 64, 2)
+	for ii := 0; ii < b.N; ii++ {
+		SquaredEuclideanDistance(data[0], data[1])
+	}
+}
+
+func BenchmarkCosineDistance(b *testing.B) {
+	data := blobs(1, 2, 64, 2)
+	for ii := 0; ii < b.N; ii++ {
+		CosineDistance(data[0], data[1])
+	}
+}
@@ -0,0 +1,52 @@
+package kmeans
+
+/*
+This module provides the types for clustering observations of float32 as well
+as float64 values, so that the embeddings of a neural network can be clustered
+without converting them. A flat row major slice of observations is split into
+rows with Rows, which doesn't copy the values.
+*/
+
+import (
+	"fmt"
+	"math"
+)
+
+// Float is the type of the values of the observations
+type Float interface {
+	~float32 | ~float64
+}
+
+// Distance is a function computing the distance between observations with values of type T
+type Distance[T Float] func(first, second []T) (float64, error)
+
+// Rows splits a flat row major slice into observations of stride values without copying
+func Rows[T Float](data []T, stride int) ([][]T, error) {
+	if stride < 1 {
+		return nil, fmt.Errorf("invalid stride %d", stride)
+	}
+	if len(data)%stride != 0 {
+		return nil, fmt.Errorf("%d values is not a multiple of the stride %d", len(data), stride)
+	}
+	rows := make([][]T, len(data)/stride)
+	for ii := range rows {
+		rows[ii] = data[ii*stride : (ii+1)*stride : (ii+1)*stride]
+	}
+	return rows, nil
+}
+
+// Squared 2-norm distance of observations of any Float type
+func SquaredEuclidean[T Float](firstVector, secondVector []T) (float64, error) {
+	distance := 0.
+	for ii := range firstVector {
+		diff := float64(firstVector[ii]) - float64(secondVector[ii])
+		distance += diff * diff
+	}
+	return distance, nil
+}
+
+// 2-norm distance of observations of any Float type
+func Euclidean[T Float](firstVector, secondVector []T) (float64, error) {
+	distance, err := SquaredEuclidean(firstVector, secondVector)
+	return math.Sqrt(distance), err
+}
@@ -1,6 +1,8 @@
 package kmeans
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 )
@@ -17,7 +19,7 @@ type ClusteredObservation struct {
 }
 
 // Distance Function: To compute the distanfe between observations
-type DistanceFunction func(first, second []float64) (float64, error)
+type DistanceFunction = Distance[float64]
 
 // Summation of two vectors
 func (observation Observation) Add(otherObservation Observation) {
@@ -34,14 +36,15 @@ func (observation Observation) Mul(scalar float64) {
 }
 
 // Dot Product of Two vectors
-func (observation Observation) InnerProduct(otherObservation Observation) {
+func (observation Observation) InnerProduct(otherObservation Observation) float64 {
+	product := 0.
 	for ii := range observation {
-		observation[ii] *= otherObservation[ii]
+		product += observation[ii] * otherObservation[ii]
 	}
+	return product
 }
 
 // Outer Product of two arrays
-// TODO: Need to be tested
 func (observation Observation) OuterProduct(otherObservation Observation) [][]float64 {
 	result := make([][]float64, len(observation))
 	for ii := range result {
@@ -55,92 +58,249 @@ func (observation Observation) OuterProduct(otherObservation Observation) [][]fl
 	return result
 }
 
-// Find the closest observation and return the distance
-// Index of observation, distance
-func near(p ClusteredObservation, mean []Observation, distanceFunction DistanceFunction) (int, float64) {
+// Find the closest mean and return the distance
+// Index of mean, distance
+func near[T Float](p []T, mean [][]T, distanceFunction Distance[T]) (int, float64, error) {
 	indexOfCluster := 0
-	minSquaredDistance, _ := distanceFunction(p.Observation, mean[0])
+	minSquaredDistance, err := distanceFunction(p, mean[0])
+	if err != nil {
+		return 0, 0, err
+	}
 	for i := 1; i < len(mean); i++ {
-		squaredDistance, _ := distanceFunction(p.Observation, mean[i])
+		squaredDistance, err := distanceFunction(p, mean[i])
+		if err != nil {
+			return 0, 0, err
+		}
 		if squaredDistance < minSquaredDistance {
 			minSquaredDistance = squaredDistance
 			indexOfCluster = i
 		}
 	}
-	return indexOfCluster, math.Sqrt(minSquaredDistance)
+	return indexOfCluster, math.Sqrt(minSquaredDistance), nil
 }
 
 // Instead of initializing randomly the seeds, make a sound decision of initializing
-func seed(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction DistanceFunction) []Observation {
-	s := make([]Observation, k)
+func seed[T Float](rng *rand.Rand, data [][]T, k int, distanceFunction Distance[T]) ([][]T, error) {
+	s := make([][]T, k)
 	first := rng.Intn(len(data))
-	s[0] = data[first].Observation
+	s[0] = data[first]
 	d2 := make([]float64, len(data))
 	for ii := 1; ii < k; ii++ {
 		var sum float64
 		for jj, p := range data {
-			_, dMin := near(p, s[:ii], distanceFunction)
+			_, dMin, err := near(p, s[:ii], distanceFunction)
+			if err != nil {
+				return nil, err
+			}
 			d2[jj] = dMin * dMin
 			sum += d2[jj]
 		}
+		if sum == 0 {
+			// All of the observations coincide with the seeds, so another cluster would stay empty
+			return nil, fmt.Errorf("there are only %d distinct observations for %d clusters", ii, k)
+		}
 		target := rng.Float64() * sum
 		jj := 0
-		for sum = d2[0]; sum < target; sum += d2[jj] {
+		for sum = d2[0]; sum < target && jj < len(d2)-1; sum += d2[jj] {
 			jj++
 		}
-		s[ii] = data[jj].Observation
+		s[ii] = data[jj]
+	}
+	return s, nil
+}
+
+// Reseed an empty cluster with the observation farthest from its mean
+func reseed[T Float](data [][]T, labels []int, mean [][]T, mLen []int, empty int, distanceFunction Distance[T]) error {
+	farthest, maxDistance := -1, -1.0
+	for ii, p := range data {
+		if mLen[labels[ii]] < 2 {
+			continue
+		}
+		distance, err := distanceFunction(p, mean[labels[ii]])
+		if err != nil {
+			return err
+		}
+		if distance > maxDistance {
+			farthest, maxDistance = ii, distance
+		}
+	}
+	if farthest < 0 {
+		return errors.New("no observation to reseed an empty cluster with")
 	}
-	return s
+	mLen[labels[farthest]]--
+	mLen[empty] = 1
+	labels[farthest] = empty
+	mean[empty] = make([]T, len(data[farthest]))
+	copy(mean[empty], data[farthest])
+	return nil
 }
 
 // K-Means Algorithm
-func kmeans(data []ClusteredObservation, mean []Observation, distanceFunction DistanceFunction, threshold int) ([]ClusteredObservation, error) {
+// Returns the labels of the observations, the means, the number of iterations and whether the clustering converged
+func kmeans[T Float](data [][]T, mean [][]T, distanceFunction Distance[T], threshold, workers int) ([]int, [][]T, int, bool, error) {
 	counter := 0
-	for ii, jj := range data {
-		closestCluster, _ := near(jj, mean, distanceFunction)
-		data[ii].ClusterNumber = closestCluster
+	labels := make([]int, len(data))
+	if _, err := assign(data, labels, mean, distanceFunction, workers); err != nil {
+		return nil, nil, 0, false, err
 	}
-	mLen := make([]int, len(mean))
-	for n := len(data[0].Observation); ; {
+	// The seeds are observations, so the means are copied before they are updated in place
+	for ii := range mean {
+		mean[ii] = append([]T(nil), mean[ii]...)
+	}
+	mLen, p := make([]int, len(mean)), newPartials(len(data), len(mean), len(data[0]))
+	for {
+		update(data, labels, mean, mLen, workers, p)
 		for ii := range mean {
-			mean[ii] = make(Observation, n)
-			mLen[ii] = 0
+			if mLen[ii] == 0 {
+				if err := reseed(data, labels, mean, mLen, ii, distanceFunction); err != nil {
+					return nil, nil, 0, false, err
+				}
+			}
 		}
-		for _, p := range data {
-			mean[p.ClusterNumber].Add(p.Observation)
-			mLen[p.ClusterNumber]++
+		changes, err := assign(data, labels, mean, distanceFunction, workers)
+		if err != nil {
+			return nil, nil, 0, false, err
 		}
-		for ii := range mean {
-			mean[ii].Mul(1 / float64(mLen[ii]))
+		counter++
+		if changes == 0 || counter > threshold {
+			return labels, mean, counter, changes == 0, nil
 		}
-		var changes int
-		for ii, p := range data {
-			if closestCluster, _ := near(p, mean, distanceFunction); closestCluster != p.ClusterNumber {
-				changes++
-				data[ii].ClusterNumber = closestCluster
+	}
+}
+
+// Update the means of the clusters and their sizes in place, keeping the mean of an empty cluster
+func update[T Float](data [][]T, labels []int, mean [][]T, mLen []int, workers int, p partials) {
+	parallel(len(data), workers, func(chunk, begin, end int) {
+		sums, sizes := p.sums[chunk], p.sizes[chunk]
+		for ii := range sums {
+			clear(sums[ii])
+			sizes[ii] = 0
+		}
+		for ii := begin; ii < end; ii++ {
+			sum := sums[labels[ii]]
+			for jj, value := range data[ii] {
+				sum[jj] += float64(value)
 			}
+			sizes[labels[ii]]++
 		}
-		counter++
-		if changes == 0 || counter > threshold {
-			return data, nil
+	})
+	for ii := range p.total {
+		clear(p.total[ii])
+		mLen[ii] = 0
+	}
+	for chunk := range p.sums {
+		for ii := range p.total {
+			p.total[ii].Add(p.sums[chunk][ii])
+			mLen[ii] += p.sizes[chunk][ii]
+		}
+	}
+	for ii := range mean {
+		if mLen[ii] > 0 {
+			p.total[ii].Mul(1 / float64(mLen[ii]))
+			for jj, value := range p.total[ii] {
+				mean[ii][jj] = T(value)
+			}
 		}
 	}
-	return data, nil
 }
 
-// K-Means Algorithm with smart seeds
+// Result is the result of a k-means clustering
+type Result struct {
+	// Labels are the clusters of the observations
+	Labels []int
+	// Centroids are the converged means of the clusters
+	Centroids []Observation
+	// Sizes are the number of observations in each cluster
+	Sizes []int
+	// Inertia is the total within cluster sum of squares
+	Inertia float64
+	// Iterations is the number of iterations used
+	Iterations int
+	// Converged is true if no observation changed cluster in the last iteration
+	Converged bool
+}
+
+// Validate the observations
+func validateData[T Float](rawData [][]T) error {
+	if len(rawData) == 0 {
+		return errors.New("there must be at least one observation")
+	}
+	n := len(rawData[0])
+	if n == 0 {
+		return errors.New("the observations must have at least one dimension")
+	}
+	for ii, jj := range rawData {
+		if len(jj) != n {
+			return fmt.Errorf("observation %d has %d dimensions instead of %d", ii, len(jj), n)
+		}
+	}
+	return nil
+}
+
+// Validate the observations and the number of clusters
+func validate[T Float](rawData [][]T, k int) error {
+	if err := validateData(rawData); err != nil {
+		return err
+	}
+	if k < 1 {
+		return errors.New("there must be at least one cluster")
+	}
+	if k > len(rawData) {
+		return fmt.Errorf("the number of clusters %d is more than the number of observations %d", k, len(rawData))
+	}
+	return nil
+}
+
+// Fit the k-means clustering with smart seeds
 // as known as K-Means ++
-func Kmeans(rngSeed int64, rawData [][]float64, k int, distanceFunction DistanceFunction, threshold int) ([]int, []Observation, error) {
+func Fit[T Float](rngSeed int64, rawData [][]T, k int, distanceFunction Distance[T], threshold int) (Result, error) {
+	return FitWorkers(rngSeed, rawData, k, distanceFunction, threshold, 1)
+}
+
+// FitWorkers fits the k-means clustering with the assignment and update steps run across workers goroutines,
+// or across all of the cpus if workers is not positive. The result doesn't depend on the number of workers
+func FitWorkers[T Float](rngSeed int64, rawData [][]T, k int, distanceFunction Distance[T], threshold, workers int) (Result, error) {
+	var result Result
+	if err := validate(rawData, k); err != nil {
+		return result, err
+	}
 	rng := rand.New(rand.NewSource(rngSeed))
-	data := make([]ClusteredObservation, len(rawData))
+	seeds, err := seed(rng, rawData, k, distanceFunction)
+	if err != nil {
+		return result, err
+	}
+	labels, mean, iterations, converged, err := kmeans(rawData, seeds, distanceFunction, threshold, workers)
+	if err != nil {
+		return result, err
+	}
+	result.Sizes = make([]int, k)
+	update(rawData, labels, mean, result.Sizes, workers, newPartials(len(rawData), k, len(rawData[0])))
+	result.Centroids = make([]Observation, k)
+	for ii, jj := range mean {
+		result.Centroids[ii] = make(Observation, len(jj))
+		for kk, value := range jj {
+			result.Centroids[ii][kk] = float64(value)
+		}
+	}
 	for ii, jj := range rawData {
-		data[ii].Observation = jj
+		for kk, value := range jj {
+			diff := float64(value) - result.Centroids[labels[ii]][kk]
+			result.Inertia += diff * diff
+		}
 	}
-	seeds := seed(rng, data, k, distanceFunction)
-	clusteredData, err := kmeans(data, seeds, distanceFunction, threshold)
-	labels := make([]int, len(clusteredData))
-	for ii, jj := range clusteredData {
-		labels[ii] = jj.ClusterNumber
+	result.Labels = labels
+	result.Iterations = iterations
+	result.Converged = converged
+	return result, nil
+}
+
+// K-Means Algorithm with smart seeds
+// as known as K-Means ++
+// Returns the labels of the observations and the converged centroids
+func Kmeans(rngSeed int64, rawData [][]float64, k int, distanceFunction DistanceFunction, threshold int) ([]int, []Observation, error) {
+	result, err := Fit(rngSeed, rawData, k, distanceFunction, threshold)
+	if err != nil {
+		return nil, nil, err
 	}
-	return labels, seeds, err
+	return result.Labels, result.Centroids, nil
 }
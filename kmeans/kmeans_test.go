@@ -0,0 +1,175 @@
+package kmeans
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestObservation(t *testing.T) {
+	observation := Observation{1, 2, 3}
+	observation.Add(Observation{1, 1, 1})
+	if !reflect.DeepEqual(observation, Observation{2, 3, 4}) {
+		t.Errorf("add: %v", observation)
+	}
+	observation.Mul(.5)
+	if !reflect.DeepEqual(observation, Observation{1, 1.5, 2}) {
+		t.Errorf("mul: %v", observation)
+	}
+	if product := observation.InnerProduct(Observation{4, 2, -1}); product != 5 {
+		t.Errorf("inner product: %f != 5", product)
+	}
+	if !reflect.DeepEqual(observation, Observation{1, 1.5, 2}) {
+		t.Errorf("the inner product modified the observation: %v", observation)
+	}
+	outer := Observation{1, 2, 3}.OuterProduct(Observation{4, 5})
+	if !reflect.DeepEqual(outer, [][]float64{{4, 5}, {8, 10}, {12, 15}}) {
+		t.Errorf("outer product: %v", outer)
+	}
+}
+
+func TestSeedDeterministic(t *testing.T) {
+	data := blobs(1, 200, 3, 5)
+	first, err := seed(rand.New(rand.NewSource(7)), data, 5, SquaredEuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := seed(rand.New(rand.NewSource(7)), data, 5, SquaredEuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("the seeds of the same rng seed are different: %v != %v", first, second)
+	}
+
+	a, err := Fit(7, data, 5, SquaredEuclideanDistance, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Fit(7, data, 5, SquaredEuclideanDistance, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the clusterings of the same rng seed are different")
+	}
+}
+
+func TestFitBlobs(t *testing.T) {
+	const k = 4
+	data := blobs(3, 400, 5, k)
+	result, err := Fit(1, data, k, SquaredEuclideanDistance, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Converged {
+		t.Error("the clustering did not converge")
+	}
+	// Each cluster should hold exactly one blob, the blob of observation ii is ii % k
+	clusters := make(map[int]int)
+	for ii, label := range result.Labels {
+		if cluster, ok := clusters[ii%k]; ok && cluster != label {
+			t.Fatalf("blob %d is split across clusters %d and %d", ii%k, cluster, label)
+		}
+		clusters[ii%k] = label
+	}
+	if len(clusters) != k {
+		t.Fatalf("%d blobs were found instead of %d", len(clusters), k)
+	}
+	for ii, size := range result.Sizes {
+		if size != len(data)/k {
+			t.Errorf("cluster %d has %d observations", ii, size)
+		}
+	}
+	if result.Inertia <= 0 || len(result.Centroids) != k {
+		t.Errorf("inertia %f with %d centroids", result.Inertia, len(result.Centroids))
+	}
+
+	labels, centroids, err := Kmeans(1, data, k, SquaredEuclideanDistance, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(labels, result.Labels) || !reflect.DeepEqual(centroids, result.Centroids) {
+		t.Error("kmeans and fit are different")
+	}
+}
+
+func TestFitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data [][]float64
+		k    int
+	}{
+		{"no observations", nil, 1},
+		{"no dimensions", [][]float64{{}, {}}, 1},
+		{"ragged", [][]float64{{1, 2}, {3}}, 1},
+		{"no clusters", [][]float64{{1}, {2}}, 0},
+		{"too many clusters", [][]float64{{1}, {2}}, 3},
+		{"identical observations", [][]float64{{1, 1}, {1, 1}, {1, 1}, {1, 1}}, 3},
+		{"too few distinct observations", [][]float64{{1}, {1}, {2}, {2}, {1}}, 3},
+	}
+	for _, test := range tests {
+		if _, err := Fit(1, test.data, test.k, SquaredEuclideanDistance, 100); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestFitDuplicates(t *testing.T) {
+	data := [][]float64{{1, 1}, {1, 1}, {5, 5}, {1, 1}, {5, 5}, {9, 9}}
+	for _, workers := range []int{1, 2} {
+		result, err := FitWorkers(1, data, 3, SquaredEuclideanDistance, 100, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes := map[int]bool{}
+		for _, size := range result.Sizes {
+			sizes[size] = true
+		}
+		if !result.Converged || result.Inertia != 0 || !sizes[1] || !sizes[2] || !sizes[3] {
+			t.Errorf("%d workers: converged %t with sizes %v and inertia %f", workers, result.Converged, result.Sizes, result.Inertia)
+		}
+	}
+	if _, err := Fit(1, data, 4, SquaredEuclideanDistance, 100); err == nil || !strings.Contains(err.Error(), "only 3 distinct") {
+		t.Errorf("4 clusters of 3 distinct observations: %v", err)
+	}
+}
+
+func BenchmarkFit(b *testing.B) {
+	data := blobs(1, 1000, 7, 8)
+	for ii := 0; ii < b.N; ii++ {
+		if _, err := Fit(1, data, 8, SquaredEuclideanDistance, 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFitFloat32(b *testing.B) {
+	data := blobs(1, 1000, 7, 8)
+	values := make([]float32, 0, 7*len(data))
+	for _, observation := range data {
+		for _, value := range observation {
+			values = append(values, float32(value))
+		}
+	}
+	rows, err := Rows(values, 7)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for ii := 0; ii < b.N; ii++ {
+		if _, err := Fit(1, rows, 8, SquaredEuclidean[float32], 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConsensus(b *testing.B) {
+	data := blobs(1, 130, 7, 40)
+	for ii := 0; ii < b.N; ii++ {
+		if _, err := Consensus(1, 10, data, 40, SquaredEuclideanDistance, -1, 1); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
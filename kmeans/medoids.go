@@ -0,0 +1,115 @@
+package kmeans
+
+/*
+This module provides k-medoids clustering with the partitioning around medoids
+(PAM) algorithm. The centers are observations rather than means, so it works
+with any distance function, including Hamming and Canberra distances.
+*/
+
+import (
+	"fmt"
+	"math"
+)
+
+// KMedoids is partitioning around medoids
+type KMedoids struct {
+	K        int
+	Distance DistanceFunction
+	// Iterations is the maximum number of swaps, or no limit if not positive
+	Iterations int
+}
+
+// Total distance of the observations to their nearest medoids
+func medoidCost(distances [][]float64, medoids []int) float64 {
+	cost := 0.
+	for ii := range distances {
+		nearest := math.MaxFloat64
+		for _, jj := range medoids {
+			if distances[ii][jj] < nearest {
+				nearest = distances[ii][jj]
+			}
+		}
+		cost += nearest
+	}
+	return cost
+}
+
+// Medoids finds the indexes of the k medoids of the observations
+func (k KMedoids) Medoids(rawData [][]float64) ([]int, error) {
+	if err := validate(rawData, k.K); err != nil {
+		return nil, err
+	}
+	distances, err := pairwise(rawData, k.Distance)
+	if err != nil {
+		return nil, err
+	}
+
+	// BUILD: greedily add the medoid that reduces the cost the most
+	medoids := make([]int, 0, k.K)
+	isMedoid := make([]bool, len(rawData))
+	for len(medoids) < k.K {
+		best, bestCost := -1, math.MaxFloat64
+		for ii := range rawData {
+			if isMedoid[ii] {
+				continue
+			}
+			if cost := medoidCost(distances, append(medoids, ii)); best < 0 || cost < bestCost {
+				best, bestCost = ii, cost
+			}
+		}
+		medoids = append(medoids, best)
+		isMedoid[best] = true
+	}
+
+	// SWAP: swap a medoid with an observation while it reduces the cost
+	cost := medoidCost(distances, medoids)
+	for iteration := 0; k.Iterations <= 0 || iteration < k.Iterations; iteration++ {
+		bestMedoid, bestObservation, bestCost := -1, -1, cost
+		for ii := range medoids {
+			for jj := range rawData {
+				if isMedoid[jj] {
+					continue
+				}
+				old := medoids[ii]
+				medoids[ii] = jj
+				if swapCost := medoidCost(distances, medoids); swapCost < bestCost {
+					bestMedoid, bestObservation, bestCost = ii, jj, swapCost
+				}
+				medoids[ii] = old
+			}
+		}
+		if bestMedoid < 0 {
+			break
+		}
+		isMedoid[medoids[bestMedoid]] = false
+		isMedoid[bestObservation] = true
+		medoids[bestMedoid] = bestObservation
+		cost = bestCost
+	}
+	return medoids, nil
+}
+
+// Cluster clusters the observations around their medoids
+func (k KMedoids) Cluster(rawData [][]float64) ([]int, error) {
+	medoids, err := k.Medoids(rawData)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]int, len(rawData))
+	for ii := range rawData {
+		nearest := math.MaxFloat64
+		for jj, medoid := range medoids {
+			distance, err := k.Distance(rawData[ii], rawData[medoid])
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(distance) {
+				return nil, fmt.Errorf("the distance between observations %d and %d is not a number", ii, medoid)
+			}
+			if jj == 0 || distance < nearest {
+				labels[ii], nearest = jj, distance
+			}
+		}
+	}
+	return labels, nil
+}
@@ -0,0 +1,139 @@
+package kmeans
+
+/*
+This module provides external evaluation metrics comparing a clustering to
+known classes: adjusted Rand index, normalized mutual information,
+homogeneity, completeness, V-measure and purity.
+*/
+
+import (
+	"errors"
+	"math"
+)
+
+// Metrics are the external evaluation metrics of a clustering
+type Metrics struct {
+	ARI          float64
+	NMI          float64
+	Homogeneity  float64
+	Completeness float64
+	VMeasure     float64
+	Purity       float64
+}
+
+// Contingency table of classes by clusters
+func contingency(classes, clusters []int) ([][]float64, []float64, []float64) {
+	classIndex, clusterIndex := make(map[int]int), make(map[int]int)
+	for ii := range classes {
+		if _, ok := classIndex[classes[ii]]; !ok {
+			classIndex[classes[ii]] = len(classIndex)
+		}
+		if _, ok := clusterIndex[clusters[ii]]; !ok {
+			clusterIndex[clusters[ii]] = len(clusterIndex)
+		}
+	}
+	table := make([][]float64, len(classIndex))
+	for ii := range table {
+		table[ii] = make([]float64, len(clusterIndex))
+	}
+	a, b := make([]float64, len(classIndex)), make([]float64, len(clusterIndex))
+	for ii := range classes {
+		jj, kk := classIndex[classes[ii]], clusterIndex[clusters[ii]]
+		table[jj][kk]++
+		a[jj]++
+		b[kk]++
+	}
+	return table, a, b
+}
+
+// Number of pairs that can be chosen from n
+func pairs(n float64) float64 {
+	return n * (n - 1) / 2
+}
+
+// Entropy of a distribution of counts summing to n
+func entropy(counts []float64, n float64) float64 {
+	h := 0.
+	for _, count := range counts {
+		if count > 0 {
+			p := count / n
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
+
+// Evaluate the clusters against the known classes
+func Evaluate(classes, clusters []int) (Metrics, error) {
+	var metrics Metrics
+	if len(classes) != len(clusters) {
+		return metrics, errors.New("the number of classes and clusters must be the same")
+	}
+	if len(classes) == 0 {
+		return metrics, errors.New("there must be at least one observation")
+	}
+	table, a, b := contingency(classes, clusters)
+	n := float64(len(classes))
+
+	index, sumA, sumB := 0., 0., 0.
+	for ii := range table {
+		for _, nij := range table[ii] {
+			index += pairs(nij)
+		}
+	}
+	for _, ai := range a {
+		sumA += pairs(ai)
+	}
+	for _, bj := range b {
+		sumB += pairs(bj)
+	}
+	expected := 0.
+	if n > 1 {
+		expected = sumA * sumB / pairs(n)
+	}
+	maximum := (sumA + sumB) / 2
+	if maximum == expected {
+		metrics.ARI = 1
+	} else {
+		metrics.ARI = (index - expected) / (maximum - expected)
+	}
+
+	hClasses, hClusters := entropy(a, n), entropy(b, n)
+	mutual := 0.
+	for ii := range table {
+		for jj, nij := range table[ii] {
+			if nij > 0 {
+				mutual += nij / n * math.Log(n*nij/(a[ii]*b[jj]))
+			}
+		}
+	}
+	if hClasses+hClusters == 0 {
+		metrics.NMI = 1
+	} else {
+		metrics.NMI = 2 * mutual / (hClasses + hClusters)
+	}
+
+	metrics.Homogeneity, metrics.Completeness = 1, 1
+	if hClasses > 0 {
+		metrics.Homogeneity = mutual / hClasses
+	}
+	if hClusters > 0 {
+		metrics.Completeness = mutual / hClusters
+	}
+	if metrics.Homogeneity+metrics.Completeness > 0 {
+		metrics.VMeasure = 2 * metrics.Homogeneity * metrics.Completeness / (metrics.Homogeneity + metrics.Completeness)
+	}
+
+	correct := 0.
+	for jj := range b {
+		best := 0.
+		for ii := range table {
+			if table[ii][jj] > best {
+				best = table[ii][jj]
+			}
+		}
+		correct += best
+	}
+	metrics.Purity = correct / n
+	return metrics, nil
+}
@@ -0,0 +1,90 @@
+package kmeans
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestEvaluatePermutation(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	classes, clusters := make([]int, 300), make([]int, 300)
+	permutation := []int{3, 0, 4, 1, 2}
+	for ii := range classes {
+		classes[ii] = rng.Intn(len(permutation))
+		clusters[ii] = permutation[classes[ii]]
+	}
+	metrics, err := Evaluate(classes, clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]float64{
+		"ari":          metrics.ARI,
+		"nmi":          metrics.NMI,
+		"homogeneity":  metrics.Homogeneity,
+		"completeness": metrics.Completeness,
+		"v-measure":    metrics.VMeasure,
+		"purity":       metrics.Purity,
+	} {
+		if !equal(value, 1) {
+			t.Errorf("%s of a permutation of the classes: %f", name, value)
+		}
+	}
+}
+
+func TestEvaluateIndependent(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	classes, clusters := make([]int, 10000), make([]int, 10000)
+	for ii := range classes {
+		classes[ii], clusters[ii] = rng.Intn(3), rng.Intn(4)
+	}
+	metrics, err := Evaluate(classes, clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(metrics.ARI) > .01 {
+		t.Errorf("ari of independent labels: %f", metrics.ARI)
+	}
+	if metrics.NMI < 0 || metrics.NMI > .01 {
+		t.Errorf("nmi of independent labels: %f", metrics.NMI)
+	}
+}
+
+func TestEvaluateHandComputed(t *testing.T) {
+	// The contingency table of classes by clusters is
+	//   2 1
+	//   0 2
+	//   0 1
+	classes := []int{0, 0, 0, 1, 1, 2}
+	clusters := []int{0, 0, 1, 1, 1, 1}
+	metrics, err := Evaluate(classes, clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The majority class of each cluster is 2 of 2 and 2 of 4
+	if !equal(metrics.Purity, 4./6) {
+		t.Errorf("purity: %f != %f", metrics.Purity, 4./6)
+	}
+	// 2 pairs agree, 4 class pairs, 7 cluster pairs and 15 pairs in total
+	if ari := (2 - 4*7/15.) / ((4+7)/2. - 4*7/15.); !equal(metrics.ARI, ari) || !equal(ari, 4./109) {
+		t.Errorf("ari: %f != %f", metrics.ARI, ari)
+	}
+	hClasses := -(.5*math.Log(.5) + 2./6*math.Log(2./6) + 1./6*math.Log(1./6))
+	hClusters := -(2./6*math.Log(2./6) + 4./6*math.Log(4./6))
+	mutual := 2./6*math.Log(6*2/(3*2.)) + 1./6*math.Log(6*1/(3*4.)) + 2./6*math.Log(6*2/(2*4.)) + 1./6*math.Log(6*1/(1*4.))
+	if nmi := 2 * mutual / (hClasses + hClusters); !equal(metrics.NMI, nmi) {
+		t.Errorf("nmi: %f != %f", metrics.NMI, nmi)
+	}
+	if !equal(metrics.Homogeneity, mutual/hClasses) || !equal(metrics.Completeness, mutual/hClusters) {
+		t.Errorf("homogeneity and completeness: %f %f", metrics.Homogeneity, metrics.Completeness)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	if _, err := Evaluate([]int{0, 1}, []int{0}); err == nil {
+		t.Error("expected an error for a different number of classes and clusters")
+	}
+	if _, err := Evaluate(nil, nil); err == nil {
+		t.Error("expected an error for no observations")
+	}
+}
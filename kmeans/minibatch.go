@@ -0,0 +1,85 @@
+package kmeans
+
+/*
+This module provides mini-batch k-means, which updates the centers with
+random batches of observations and per center learning rates.
+https://www.eecs.tufts.edu/~dsculley/papers/fastkmeans.pdf
+*/
+
+import (
+	"math/rand"
+)
+
+// MiniBatch is mini-batch k-means with k-means++ seeds
+type MiniBatch struct {
+	Seed       int64
+	K          int
+	Distance   DistanceFunction
+	Batch      int
+	Iterations int
+}
+
+// Centers finds the centers of the k clusters of the observations
+func (m MiniBatch) Centers(rawData [][]float64) ([]Observation, error) {
+	if err := validate(rawData, m.K); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(m.Seed))
+	seeds, err := seed(rng, rawData, m.K, m.Distance)
+	if err != nil {
+		return nil, err
+	}
+	// The centers share their values with the means used to find the nearest center
+	centers, means := make([]Observation, m.K), make([][]float64, m.K)
+	for ii, jj := range seeds {
+		centers[ii] = make(Observation, len(jj))
+		copy(centers[ii], jj)
+		means[ii] = centers[ii]
+	}
+	batch := m.Batch
+	if batch < 1 || batch > len(rawData) {
+		batch = len(rawData)
+	}
+	counts, labels := make([]int, m.K), make([]int, len(rawData))
+	indexes := make([]int, batch)
+	for iteration := 0; iteration < m.Iterations; iteration++ {
+		for ii := range indexes {
+			indexes[ii] = rng.Intn(len(rawData))
+			closestCluster, _, err := near(rawData[indexes[ii]], means, m.Distance)
+			if err != nil {
+				return nil, err
+			}
+			labels[indexes[ii]] = closestCluster
+		}
+		for _, ii := range indexes {
+			counts[labels[ii]]++
+			rate := 1 / float64(counts[labels[ii]])
+			center := centers[labels[ii]]
+			for jj := range center {
+				center[jj] = (1-rate)*center[jj] + rate*rawData[ii][jj]
+			}
+		}
+	}
+	return centers, nil
+}
+
+// Cluster clusters the observations with mini-batch k-means
+func (m MiniBatch) Cluster(rawData [][]float64) ([]int, error) {
+	centers, err := m.Centers(rawData)
+	if err != nil {
+		return nil, err
+	}
+	means := make([][]float64, len(centers))
+	for ii, center := range centers {
+		means[ii] = center
+	}
+	labels := make([]int, len(rawData))
+	for ii, jj := range rawData {
+		closestCluster, _, err := near(jj, means, m.Distance)
+		if err != nil {
+			return nil, err
+		}
+		labels[ii] = closestCluster
+	}
+	return labels, nil
+}
@@ -0,0 +1,106 @@
+package kmeans
+
+/*
+This module provides the parallel assignment and update steps of k-means. The
+observations are split into small chunks of a fixed size which are processed by
+a number of worker goroutines, so that even a few hundred observations are
+spread across the workers. The partial sums of the chunks are reduced in order,
+so the clustering doesn't depend on the number of workers.
+*/
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Number of observations in a chunk
+const chunkSize = 64
+
+// Call f with the bounds of each chunk of n observations across workers goroutines,
+// or across all of the cpus if workers is not positive
+func parallel(n, workers int, f func(chunk, begin, end int)) {
+	chunks := (n + chunkSize - 1) / chunkSize
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if workers > chunks {
+		workers = chunks
+	}
+	if workers < 2 {
+		for ii := 0; ii < chunks; ii++ {
+			f(ii, ii*chunkSize, min((ii+1)*chunkSize, n))
+		}
+		return
+	}
+	indexes := make(chan int, chunks)
+	for ii := 0; ii < chunks; ii++ {
+		indexes <- ii
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ii := range indexes {
+				f(ii, ii*chunkSize, min((ii+1)*chunkSize, n))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Partial sums and sizes of the clusters of each chunk of the update step and their totals,
+// which are allocated once for a clustering rather than for each iteration
+type partials struct {
+	sums  [][]Observation
+	sizes [][]int
+	total []Observation
+}
+
+// Allocate the partial sums of the k clusters of n observations of d dimensions
+func newPartials(n, k, d int) partials {
+	chunks := (n + chunkSize - 1) / chunkSize
+	p := partials{
+		sums:  make([][]Observation, chunks),
+		sizes: make([][]int, chunks),
+		total: make([]Observation, k),
+	}
+	for chunk := range p.sums {
+		p.sums[chunk], p.sizes[chunk] = make([]Observation, k), make([]int, k)
+		for ii := range p.sums[chunk] {
+			p.sums[chunk][ii] = make(Observation, d)
+		}
+	}
+	for ii := range p.total {
+		p.total[ii] = make(Observation, d)
+	}
+	return p
+}
+
+// Assign each observation to its nearest mean, returning the number of observations which changed cluster
+func assign[T Float](data [][]T, labels []int, mean [][]T, distanceFunction Distance[T], workers int) (int, error) {
+	chunks := (len(data) + chunkSize - 1) / chunkSize
+	changes, errs := make([]int, chunks), make([]error, chunks)
+	parallel(len(data), workers, func(chunk, begin, end int) {
+		for ii := begin; ii < end; ii++ {
+			closestCluster, _, err := near(data[ii], mean, distanceFunction)
+			if err != nil {
+				errs[chunk] = err
+				return
+			}
+			if closestCluster != labels[ii] {
+				changes[chunk]++
+				labels[ii] = closestCluster
+			}
+		}
+	})
+	total := 0
+	for ii := range changes {
+		if errs[ii] != nil {
+			return 0, errs[ii]
+		}
+		total += changes[ii]
+	}
+	return total, nil
+}
@@ -0,0 +1,125 @@
+package kmeans
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// blobs generates n observations of d dimensions around k gaussian centers
+func blobs(seed int64, n, d, k int) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	centers := make([][]float64, k)
+	for ii := range centers {
+		centers[ii] = make([]float64, d)
+		for jj := range centers[ii] {
+			centers[ii][jj] = 10 * rng.Float64()
+		}
+	}
+	data := make([][]float64, n)
+	for ii := range data {
+		data[ii] = make([]float64, d)
+		for jj := range data[ii] {
+			data[ii][jj] = centers[ii%k][jj] + rng.NormFloat64()/2
+		}
+	}
+	return data
+}
+
+func TestFitWorkersDeterministic(t *testing.T) {
+	for _, n := range []int{130, 1300} {
+		data := blobs(1, n, 7, 40)
+		serial, err := FitWorkers(1, data, 40, SquaredEuclideanDistance, 100, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, workers := range []int{2, 4, 0} {
+			result, err := FitWorkers(1, data, 40, SquaredEuclideanDistance, 100, workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Labels, serial.Labels) {
+				t.Errorf("%d observations: the labels of %d workers are different", n, workers)
+			}
+			if result.Inertia != serial.Inertia {
+				t.Errorf("%d observations: the inertia of %d workers %f != %f", n, workers, result.Inertia, serial.Inertia)
+			}
+		}
+	}
+}
+
+func TestRestartsWorkers(t *testing.T) {
+	data := blobs(1, 300, 3, 6)
+	serial, err := Best(1, 4, data, 6, SquaredEuclideanDistance, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consensus, err := Consensus(1, 4, data, 6, SquaredEuclideanDistance, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{2, 0} {
+		result, err := Best(1, 4, data, 6, SquaredEuclideanDistance, 100, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(result.Labels, serial.Labels) || result.Inertia != serial.Inertia {
+			t.Errorf("the best clustering of %d workers is different", workers)
+		}
+		c, err := Consensus(1, 4, data, 6, SquaredEuclideanDistance, 100, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c, consensus) {
+			t.Errorf("the consensus of %d workers is different", workers)
+		}
+	}
+}
+
+func TestUpdateInPlace(t *testing.T) {
+	data := blobs(1, 300, 3, 6)
+	original := make([][]float64, len(data))
+	for ii := range data {
+		original[ii] = append([]float64(nil), data[ii]...)
+	}
+	if _, err := FitWorkers(1, data, 6, SquaredEuclideanDistance, 100, 2); err != nil {
+		t.Fatal(err)
+	}
+	// The means are seeded with observations, which must not be updated
+	if !reflect.DeepEqual(data, original) {
+		t.Error("fitting modified the observations")
+	}
+}
+
+func TestParallelChunks(t *testing.T) {
+	visited := make([]int, 1300)
+	parallel(len(visited), 4, func(chunk, begin, end int) {
+		for ii := begin; ii < end; ii++ {
+			visited[ii]++
+		}
+	})
+	for ii, count := range visited {
+		if count != 1 {
+			t.Fatalf("observation %d was visited %d times", ii, count)
+		}
+	}
+}
+
+func BenchmarkFitWorkers(b *testing.B) {
+	data := blobs(1, 1300, 7, 40)
+	for _, workers := range []int{1, 2, 4, 0} {
+		name := fmt.Sprintf("workers=%d", workers)
+		if workers == 0 {
+			name = fmt.Sprintf("workers=cpus(%d)", runtime.NumCPU())
+		}
+		b.Run(name, func(b *testing.B) {
+			for ii := 0; ii < b.N; ii++ {
+				if _, err := FitWorkers(1, data, 40, SquaredEuclideanDistance, 100, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
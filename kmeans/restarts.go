@@ -0,0 +1,86 @@
+package kmeans
+
+/*
+This module provides multiple restarts of k-means: the best of n restarts by
+inertia, and the consensus (co-association) matrix of n restarts, which counts
+how many times each pair of observations is clustered together.
+*/
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Fit n k-means clusterings with the seeds rngSeed, rngSeed+1, ... of workers goroutines each, or of all
+// of the cpus if workers is not positive, running as many clusterings concurrently as there are cpus to spare
+func restarts[T Float](rngSeed int64, n int, rawData [][]T, k int, distanceFunction Distance[T], threshold, workers int) ([]Result, error) {
+	if n < 1 {
+		return nil, errors.New("there must be at least one restart")
+	}
+	results, errs := make([]Result, n), make([]error, n)
+	indexes := make(chan int, n)
+	for ii := 0; ii < n; ii++ {
+		indexes <- ii
+	}
+	close(indexes)
+	concurrent := 1
+	if workers > 0 {
+		concurrent = max(1, runtime.NumCPU()/workers)
+	}
+	var wg sync.WaitGroup
+	for cpu := 0; cpu < concurrent && cpu < n; cpu++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ii := range indexes {
+				results[ii], errs[ii] = FitWorkers(rngSeed+int64(ii), rawData, k, distanceFunction, threshold, workers)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Best fits n k-means clusterings of workers goroutines each and returns the one with the lowest inertia
+func Best[T Float](rngSeed int64, n int, rawData [][]T, k int, distanceFunction Distance[T], threshold, workers int) (Result, error) {
+	results, err := restarts(rngSeed, n, rawData, k, distanceFunction, threshold, workers)
+	if err != nil {
+		return Result{}, err
+	}
+	best := 0
+	for ii := range results {
+		if results[ii].Inertia < results[best].Inertia {
+			best = ii
+		}
+	}
+	return results[best], nil
+}
+
+// Consensus fits n k-means clusterings of workers goroutines each and returns the co-association matrix,
+// where entry i, j is the number of clusterings with observations i and j in the same cluster
+func Consensus[T Float](rngSeed int64, n int, rawData [][]T, k int, distanceFunction Distance[T], threshold, workers int) ([][]float64, error) {
+	results, err := restarts(rngSeed, n, rawData, k, distanceFunction, threshold, workers)
+	if err != nil {
+		return nil, err
+	}
+	consensus := make([][]float64, len(rawData))
+	for ii := range consensus {
+		consensus[ii] = make([]float64, len(rawData))
+	}
+	for _, result := range results {
+		for ii, target := range result.Labels {
+			for jj, label := range result.Labels {
+				if label == target {
+					consensus[ii][jj]++
+				}
+			}
+		}
+	}
+	return consensus, nil
+}
@@ -0,0 +1,280 @@
+package kmeans
+
+/*
+This module provides internal evaluation of clusterings for selecting the number
+of clusters: the silhouette score, the Davies-Bouldin index, the gap statistic
+and the elbow of the inertia curve.
+https://en.wikipedia.org/wiki/Determining_the_number_of_clusters_in_a_data_set
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Silhouette is the mean silhouette score of the observations, which is in [-1, 1] and higher is better
+func Silhouette(rawData [][]float64, labels []int, distanceFunction DistanceFunction) (float64, error) {
+	if len(rawData) != len(labels) {
+		return 0, errors.New("the number of observations and labels must be the same")
+	}
+	sizes := make(map[int]int)
+	for _, label := range labels {
+		sizes[label]++
+	}
+	if len(sizes) < 2 {
+		return 0, nil
+	}
+	distances, err := pairwise(rawData, distanceFunction)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.
+	for ii := range rawData {
+		if sizes[labels[ii]] < 2 {
+			continue
+		}
+		sums := make(map[int]float64)
+		for jj, distance := range distances[ii] {
+			if jj != ii {
+				sums[labels[jj]] += distance
+			}
+		}
+		a, b := sums[labels[ii]]/float64(sizes[labels[ii]]-1), math.MaxFloat64
+		for label, sum := range sums {
+			if label != labels[ii] {
+				b = math.Min(b, sum/float64(sizes[label]))
+			}
+		}
+		if max := math.Max(a, b); max > 0 {
+			total += (b - a) / max
+		}
+	}
+	return total / float64(len(rawData)), nil
+}
+
+// Mean of the observations of each cluster and the number of clusters
+func centroids(rawData [][]float64, labels []int) (map[int]Observation, map[int]int) {
+	means, sizes := make(map[int]Observation), make(map[int]int)
+	for ii, label := range labels {
+		if _, ok := means[label]; !ok {
+			means[label] = make(Observation, len(rawData[ii]))
+		}
+		means[label].Add(rawData[ii])
+		sizes[label]++
+	}
+	for label, mean := range means {
+		mean.Mul(1 / float64(sizes[label]))
+	}
+	return means, sizes
+}
+
+// DaviesBouldin is the Davies-Bouldin index of the clustering, which is non-negative and lower is better
+func DaviesBouldin(rawData [][]float64, labels []int) (float64, error) {
+	if len(rawData) != len(labels) {
+		return 0, errors.New("the number of observations and labels must be the same")
+	}
+	means, _ := centroids(rawData, labels)
+	if len(means) < 2 {
+		return 0, nil
+	}
+	scatter, counts := make(map[int]float64), make(map[int]float64)
+	for ii, label := range labels {
+		distance, _ := EuclideanDistance(rawData[ii], means[label])
+		scatter[label] += distance
+		counts[label]++
+	}
+	for label := range scatter {
+		scatter[label] /= counts[label]
+	}
+	total := 0.
+	for ii, first := range means {
+		worst := 0.
+		for jj, second := range means {
+			if ii == jj {
+				continue
+			}
+			distance, _ := EuclideanDistance(first, second)
+			if distance == 0 {
+				continue
+			}
+			worst = math.Max(worst, (scatter[ii]+scatter[jj])/distance)
+		}
+		total += worst
+	}
+	return total / float64(len(means)), nil
+}
+
+// Number of distinct observations
+func distinct(rawData [][]float64) int {
+	seen := make(map[string]bool)
+	key := make([]byte, 0, 8*len(rawData[0]))
+	for _, jj := range rawData {
+		key = key[:0]
+		for _, value := range jj {
+			key = binary.LittleEndian.AppendUint64(key, math.Float64bits(value))
+		}
+		seen[string(key)] = true
+	}
+	return len(seen)
+}
+
+// Selection are the curves of the internal evaluation of k-means clusterings across a range of k
+type Selection struct {
+	K             []int
+	Inertia       []float64
+	Silhouette    []float64
+	DaviesBouldin []float64
+	Gap           []float64
+	GapError      []float64
+}
+
+// Select clusters the observations with the best of restarts k-means clusterings for each k from minK to maxK,
+// or to the number of distinct observations if it is smaller, with workers goroutines each, and evaluates the clusterings, comparing the inertia to that of references uniform reference data sets for
+// the gap statistic
+func Select(rngSeed int64, rawData [][]float64, minK, maxK, references, restarts, workers int) (Selection, error) {
+	var selection Selection
+	if minK < 1 || maxK < minK {
+		return selection, fmt.Errorf("invalid range of clusters %d to %d", minK, maxK)
+	}
+	if err := validate(rawData, maxK); err != nil {
+		return selection, err
+	}
+	// There can be no more clusters than distinct observations
+	if n := distinct(rawData); n < maxK {
+		if n < minK {
+			return selection, fmt.Errorf("there are only %d distinct observations for %d clusters", n, minK)
+		}
+		maxK = n
+	}
+	lower, upper := make(Observation, len(rawData[0])), make(Observation, len(rawData[0]))
+	copy(lower, rawData[0])
+	copy(upper, rawData[0])
+	for _, jj := range rawData {
+		for kk, value := range jj {
+			lower[kk], upper[kk] = math.Min(lower[kk], value), math.Max(upper[kk], value)
+		}
+	}
+	rng := rand.New(rand.NewSource(rngSeed))
+	uniform := make([][][]float64, references)
+	for ii := range uniform {
+		uniform[ii] = make([][]float64, len(rawData))
+		for jj := range uniform[ii] {
+			uniform[ii][jj] = make([]float64, len(lower))
+			for kk := range lower {
+				uniform[ii][jj][kk] = lower[kk] + rng.Float64()*(upper[kk]-lower[kk])
+			}
+		}
+	}
+	logInertia := func(inertia float64) float64 {
+		return math.Log(math.Max(inertia, math.SmallestNonzeroFloat64))
+	}
+
+	for k := minK; k <= maxK; k++ {
+		result, err := Best(rngSeed, restarts, rawData, k, SquaredEuclideanDistance, 100, workers)
+		if err != nil {
+			return selection, err
+		}
+		silhouette, err := Silhouette(rawData, result.Labels, EuclideanDistance)
+		if err != nil {
+			return selection, err
+		}
+		daviesBouldin, err := DaviesBouldin(rawData, result.Labels)
+		if err != nil {
+			return selection, err
+		}
+		logs := make([]float64, references)
+		mean := 0.
+		for ii, reference := range uniform {
+			r, err := Best(rngSeed, restarts, reference, k, SquaredEuclideanDistance, 100, workers)
+			if err != nil {
+				return selection, err
+			}
+			logs[ii] = logInertia(r.Inertia)
+			mean += logs[ii]
+		}
+		variance := 0.
+		if references > 0 {
+			mean /= float64(references)
+			for _, value := range logs {
+				variance += (value - mean) * (value - mean)
+			}
+			variance /= float64(references)
+		}
+		selection.K = append(selection.K, k)
+		selection.Inertia = append(selection.Inertia, result.Inertia)
+		selection.Silhouette = append(selection.Silhouette, silhouette)
+		selection.DaviesBouldin = append(selection.DaviesBouldin, daviesBouldin)
+		selection.Gap = append(selection.Gap, mean-logInertia(result.Inertia))
+		selection.GapError = append(selection.GapError, math.Sqrt(variance)*math.Sqrt(1+1/float64(max(references, 1))))
+	}
+	return selection, nil
+}
+
+// Best is the k selected by a criterion: silhouette (highest score), daviesbouldin (lowest index),
+// gap (smallest k within one standard error of the gap of k+1) or elbow (farthest inertia from the chord of the curve)
+func (s Selection) Best(criterion string) (int, error) {
+	if len(s.K) == 0 {
+		return 0, errors.New("there are no clusterings to select from")
+	}
+	best := 0
+	switch criterion {
+	case "silhouette":
+		for ii := range s.K {
+			if s.Silhouette[ii] > s.Silhouette[best] {
+				best = ii
+			}
+		}
+	case "daviesbouldin":
+		// The index is not defined for a single cluster
+		for best < len(s.K)-1 && s.K[best] < 2 {
+			best++
+		}
+		for ii := range s.K {
+			if s.K[ii] > 1 && s.DaviesBouldin[ii] < s.DaviesBouldin[best] {
+				best = ii
+			}
+		}
+	case "gap":
+		best = -1
+		for ii := 0; ii < len(s.K)-1; ii++ {
+			if s.Gap[ii] >= s.Gap[ii+1]-s.GapError[ii+1] {
+				best = ii
+				break
+			}
+		}
+		if best < 0 {
+			best = 0
+			for ii := range s.K {
+				if s.Gap[ii] > s.Gap[best] {
+					best = ii
+				}
+			}
+		}
+	case "elbow":
+		last := len(s.K) - 1
+		if last < 2 {
+			break
+		}
+		x0, y0 := float64(s.K[0]), s.Inertia[0]
+		dx, dy := float64(s.K[last])-x0, s.Inertia[last]-y0
+		xScale, yScale := math.Abs(dx), math.Abs(dy)
+		if yScale == 0 {
+			break
+		}
+		farthest := -1.
+		for ii := range s.K {
+			// Perpendicular distance of the normalized point to the normalized chord
+			x, y := (float64(s.K[ii])-x0)/xScale, (s.Inertia[ii]-y0)/yScale
+			distance := math.Abs(x*dy/yScale - y*dx/xScale)
+			if distance > farthest {
+				best, farthest = ii, distance
+			}
+		}
+	default:
+		return 0, fmt.Errorf("unknown criterion %s, expected one of silhouette, daviesbouldin, gap, elbow", criterion)
+	}
+	return s.K[best], nil
+}
@@ -0,0 +1,122 @@
+package kmeans
+
+import (
+	"testing"
+)
+
+// Blobs for which a single k-means clustering with 4 clusters gets stuck in a local optimum
+var selectionBlobs = []struct {
+	seed    int64
+	n, d, k int
+}{
+	{1, 100, 2, 4},
+	{5, 100, 3, 4},
+	{1, 400, 5, 4},
+}
+
+func TestSilhouetteHandComputed(t *testing.T) {
+	data := [][]float64{{0}, {1}, {10}, {11}}
+	silhouette, err := Silhouette(data, []int{0, 0, 1, 1}, EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The scores of the observations are 9.5/10.5, 8.5/9.5, 8.5/9.5 and 9.5/10.5
+	if expected := (9.5/10.5 + 8.5/9.5) / 2; !equal(silhouette, expected) {
+		t.Errorf("silhouette %f != %f", silhouette, expected)
+	}
+	// The scatter of each cluster is .5 and the centroids are 10 apart
+	daviesBouldin, err := DaviesBouldin(data, []int{0, 0, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equal(daviesBouldin, .1) {
+		t.Errorf("davies-bouldin %f != .1", daviesBouldin)
+	}
+	if _, err := Silhouette(data, []int{0}, EuclideanDistance); err == nil {
+		t.Error("expected an error for fewer labels than observations")
+	}
+}
+
+func TestSilhouetteDaviesBouldinBlobs(t *testing.T) {
+	for _, blob := range selectionBlobs {
+		data := blobs(blob.seed, blob.n, blob.d, blob.k)
+		bestSilhouette, bestDaviesBouldin := 0, 0
+		maxSilhouette, minDaviesBouldin := -1., 0.
+		for k := 2; k <= 8; k++ {
+			result, err := Best(1, 10, data, k, SquaredEuclideanDistance, 100, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			silhouette, err := Silhouette(data, result.Labels, EuclideanDistance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			daviesBouldin, err := DaviesBouldin(data, result.Labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if silhouette > maxSilhouette {
+				bestSilhouette, maxSilhouette = k, silhouette
+			}
+			if bestDaviesBouldin == 0 || daviesBouldin < minDaviesBouldin {
+				bestDaviesBouldin, minDaviesBouldin = k, daviesBouldin
+			}
+		}
+		if bestSilhouette != blob.k || bestDaviesBouldin != blob.k {
+			t.Errorf("blobs %d: silhouette picked %d and davies-bouldin picked %d clusters", blob.seed, bestSilhouette, bestDaviesBouldin)
+		}
+	}
+}
+
+func TestSelectBlobs(t *testing.T) {
+	for _, blob := range selectionBlobs {
+		data := blobs(blob.seed, blob.n, blob.d, blob.k)
+		selection, err := Select(1, data, 2, 8, 5, 10, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		single, err := Fit(1, data, blob.k, SquaredEuclideanDistance, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inertia := selection.Inertia[blob.k-2]; inertia > single.Inertia {
+			t.Errorf("blobs %d: the inertia of the restarts %f is more than that of one clustering %f", blob.seed, inertia, single.Inertia)
+		}
+		for _, criterion := range []string{"silhouette", "daviesbouldin", "gap", "elbow"} {
+			k, err := selection.Best(criterion)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k != blob.k {
+				t.Errorf("blobs %d: %s picked %d clusters", blob.seed, criterion, k)
+			}
+		}
+	}
+}
+
+func TestSelectDuplicates(t *testing.T) {
+	data := [][]float64{{0, 0}, {0, 0}, {0, 1}, {5, 5}, {5, 5}, {5, 6}, {9, 0}, {9, 0}}
+	selection, err := Select(1, data, 2, 8, 5, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.K) != 4 || selection.K[3] != 5 {
+		t.Errorf("selected from %v, expected up to the 5 distinct observations", selection.K)
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	data := blobs(1, 20, 2, 2)
+	if _, err := Select(1, data, 3, 2, 5, 1, 1); err == nil {
+		t.Error("expected an error for an empty range of clusters")
+	}
+	if _, err := Select(1, data, 2, 3, 5, 0, 1); err == nil {
+		t.Error("expected an error for no restarts")
+	}
+	if _, err := Select(1, [][]float64{{1}, {1}, {2}, {2}}, 3, 4, 5, 1, 1); err == nil {
+		t.Error("expected an error for fewer distinct observations than clusters")
+	}
+	if _, err := (Selection{}).Best("silhouette"); err == nil {
+		t.Error("expected an error for no clusterings")
+	}
+}
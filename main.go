@@ -9,6 +9,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+
+	"github.com/pointlander/frozenstar/truth"
 )
 
 const (
@@ -20,6 +23,8 @@ const (
 	Width = 16
 	// Output is the size of the output
 	Output = 7
+	// ObjectInput is the size of an object token
+	ObjectInput = 10 + 30 + 30 + 30 + 30 + 4 + 1
 )
 
 // Example is a learning example
@@ -28,9 +33,16 @@ type Example struct {
 	Output [][]byte `json:"output"`
 }
 
+// Test is a test example with a sealed output
+type Test struct {
+	Input  [][]byte   `json:"input"`
+	Output truth.Grid `json:"output"`
+}
+
 // Set is a set of examples
 type Set struct {
-	Test  []Example `json:"test"`
+	Name  string    `json:"-"`
+	Test  []Test    `json:"test"`
 	Train []Example `json:"train"`
 }
 
@@ -50,6 +62,7 @@ func Load() []Set {
 		if err != nil {
 			panic(err)
 		}
+		sets[i].Name = strings.TrimSuffix(dir.Name(), ".json")
 	}
 	fmt.Println("loaded", len(sets))
 	test, train := 0, 0
@@ -86,14 +99,74 @@ type Pair struct {
 var (
 	// FlagCluster clustering mode
 	FlagCluster = flag.Bool("cluster", false, "clustering mode")
+	// FlagAlgorithm is the clustering algorithm
+	FlagAlgorithm = flag.String("algorithm", "kmeans", "clustering algorithm: kmeans, kmedoids, minibatch, dbscan or agglomerative")
+	// FlagEps is the neighborhood radius of dbscan
+	FlagEps = flag.Float64("eps", .5, "neighborhood radius of dbscan")
+	// FlagMinPts is the minimum number of neighbors of a dbscan core point
+	FlagMinPts = flag.Int("minpts", 4, "minimum number of neighbors of a dbscan core point")
+	// FlagWorkers is the number of goroutines of each k-means clustering
+	FlagWorkers = flag.Int("workers", 1, "number of goroutines of each k-means clustering, or all of the cpus if not positive")
+	// FlagLinkage is the linkage of agglomerative clustering
+	FlagLinkage = flag.String("linkage", "average", "linkage of agglomerative clustering: single, complete or average")
+	// FlagSelect is the criterion for selecting the number of clusters
+	FlagSelect = flag.String("select", "", "criterion for selecting the number of clusters: silhouette, daviesbouldin, gap or elbow")
+	// FlagMinK is the smallest number of clusters to select from
+	FlagMinK = flag.Int("kmin", 2, "smallest number of clusters to select from")
+	// FlagMaxK is the largest number of clusters to select from
+	FlagMaxK = flag.Int("kmax", 0, "largest number of clusters to select from, 0 for twice the number of tasks")
+	// FlagReferences is the number of reference data sets of the gap statistic
+	FlagReferences = flag.Int("references", 10, "number of reference data sets of the gap statistic")
+	// FlagRestarts is the number of k-means restarts for each number of clusters when selecting
+	FlagRestarts = flag.Int("restarts", 10, "number of k-means restarts for each number of clusters when selecting")
 	// FlagEncdec encoder decoder model
 	FlagEncdec = flag.Bool("encdec", false, "encoder decoder model")
+	// FlagConditional conditions the encoder decoder model on the train pairs of a task
+	FlagConditional = flag.Bool("conditional", false, "condition the encoder decoder model on the train pairs of a task")
+	// FlagDecoder is the file the trained decoder is saved to
+	FlagDecoder = flag.String("decoder", "decoder.gob", "file the trained decoder is saved to")
 	// FlagSA self attention model
 	FlagSA = flag.Bool("sa", false, "self attention model")
+	// FlagCost is the weighted cost of the sa and ac modes
+	FlagCost = flag.String("cost", "", "weighted cost of the sa and ac modes such as mse:1,xent:0.5, empty for the mode default")
+	// FlagOptimizer is the optimizer of the models
+	FlagOptimizer = flag.String("optimizer", "sampling", "optimizer of the models: sampling, cmaes, ga, spsa or fd")
+	// FlagGradient trains the sa and ac modes with gradient descent
+	FlagGradient = flag.Bool("gradient", false, "train the sa and ac modes with gradient descent")
+	// FlagRate is the learning rate of gradient descent
+	FlagRate = flag.Float64("rate", .01, "learning rate of gradient descent")
+	// FlagObjects uses object tokens instead of pixels
+	FlagObjects = flag.Bool("objects", false, "use object tokens instead of pixels")
 	// FlagAC is an autocoder model
 	FlagAC = flag.Bool("ac", false, "autocoder model")
+	// FlagDSL program synthesis mode
+	FlagDSL = flag.Bool("dsl", false, "program synthesis mode")
+	// FlagDepth is the maximum number of primitives in a program
+	FlagDepth = flag.Int("depth", 2, "maximum number of primitives in a program")
+	// FlagEnsemble ensemble mode
+	FlagEnsemble = flag.Bool("ensemble", false, "ensemble mode")
+	// FlagSolvers are the solvers of the ensemble
+	FlagSolvers = flag.String("solvers", "dsl,ac,sa", "comma separated solvers of the ensemble")
+	// FlagSimilar finds the tasks most similar to a task
+	FlagSimilar = flag.String("similar", "", "find the tasks most similar to a task")
+	// FlagNeighbors is the number of similar tasks to find
+	FlagNeighbors = flag.Int("neighbors", 10, "number of similar tasks to find")
+	// FlagExport is the file prefix for exporting the pair embeddings
+	FlagExport = flag.String("export", "", "file prefix for exporting the pair embeddings")
+	// FlagTSV also exports the pair embeddings for the tensorboard projector
+	FlagTSV = flag.Bool("tsv", false, "also export the pair embeddings for the tensorboard projector")
+	// FlagValidate leave one out validation mode
+	FlagValidate = flag.Bool("validate", false, "leave one out validation mode")
+	// FlagCandidates is the number of candidate solutions to rank
+	FlagCandidates = flag.Int("candidates", 3, "number of candidate solutions to rank")
 	// FlagSets is the number of sets to learn with
 	FlagSets = flag.Int("sets", 2, "number of sets to learn with")
+	// FlagTime is the wall clock budget of an optimization
+	FlagTime = flag.Duration("time", 0, "wall clock budget of an optimization, 0 for no limit")
+	// FlagIterations is the iteration budget of an optimization
+	FlagIterations = flag.Int("iterations", 0, "iteration budget of an optimization, 0 for the mode default")
+	// FlagPatience is the number of iterations without improvement before stopping
+	FlagPatience = flag.Int("patience", 0, "iterations without improvement before stopping, 0 to disable")
 )
 
 func main() {
@@ -103,13 +176,37 @@ func main() {
 		Cluster()
 		return
 	} else if *FlagEncdec {
+		if *FlagConditional {
+			Conditional()
+			return
+		}
 		Encdec()
 		return
 	} else if *FlagSA {
+		if *FlagObjects {
+			SAObjects()
+			return
+		}
 		SA()
 		return
 	} else if *FlagAC {
+		if *FlagObjects {
+			ACObjects()
+			return
+		}
 		AC()
 		return
+	} else if *FlagValidate {
+		Validation()
+		return
+	} else if *FlagDSL {
+		DSL()
+		return
+	} else if *FlagEnsemble {
+		Ensemble()
+		return
+	} else if *FlagSimilar != "" {
+		Similar(*FlagSimilar)
+		return
 	}
 }
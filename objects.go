@@ -0,0 +1,154 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// Object is a connected component of an image
+type Object struct {
+	Color  uint8
+	Colors [10]int
+	X      int
+	Y      int
+	W      int
+	H      int
+	Mask   [][]bool
+	I      []Pixel
+}
+
+// Size is the number of pixels in the object
+func (o Object) Size() int {
+	return len(o.I)
+}
+
+// Position is the center of mass of the object
+func (o Object) Position() (x, y float64) {
+	for _, p := range o.I {
+		x += float64(p.X)
+		y += float64(p.Y)
+	}
+	size := float64(len(o.I))
+	return x / size, y / size
+}
+
+// NewImage creates an image from a grid of colors
+func NewImage(grid [][]byte) Image {
+	image := Image{
+		H: len(grid),
+	}
+	if len(grid) > 0 {
+		image.W = len(grid[0])
+	}
+	for j, v := range grid {
+		for i := range v {
+			image.I = append(image.I, Pixel{
+				C: v[i],
+				X: i,
+				Y: j,
+			})
+		}
+	}
+	return image
+}
+
+// Grid returns the image as a grid of colors
+func (i Image) Grid() [][]byte {
+	grid := make([][]byte, i.H)
+	for j := range grid {
+		grid[j] = make([]byte, i.W)
+	}
+	for _, p := range i.I {
+		grid[p.Y][p.X] = p.C
+	}
+	return grid
+}
+
+// Background is the most common color of the image
+func (i Image) Background() uint8 {
+	var histogram [10]int
+	for _, p := range i.I {
+		histogram[p.C]++
+	}
+	background := 0
+	for color, count := range histogram {
+		if count > histogram[background] {
+			background = color
+		}
+	}
+	return uint8(background)
+}
+
+// Objects extracts the connected components of an image that are not the background
+// color. With eight the diagonal neighbors are connected, and with multi neighbors
+// of different colors belong to the same object.
+func (i Image) Objects(background uint8, eight, multi bool) []Object {
+	grid := i.Grid()
+	visited := make([][]bool, i.H)
+	for j := range visited {
+		visited[j] = make([]bool, i.W)
+	}
+	neighbors := [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	if eight {
+		neighbors = append(neighbors, [2]int{1, 1}, [2]int{1, -1}, [2]int{-1, 1}, [2]int{-1, -1})
+	}
+	objects := make([]Object, 0, 8)
+	for y := 0; y < i.H; y++ {
+		for x := 0; x < i.W; x++ {
+			if visited[y][x] || grid[y][x] == background {
+				continue
+			}
+			color := grid[y][x]
+			visited[y][x] = true
+			stack := []Pixel{{C: color, X: x, Y: y}}
+			object := Object{}
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				object.I = append(object.I, p)
+				object.Colors[p.C]++
+				for _, n := range neighbors {
+					xx, yy := p.X+n[0], p.Y+n[1]
+					if xx < 0 || yy < 0 || xx >= i.W || yy >= i.H || visited[yy][xx] {
+						continue
+					}
+					c := grid[yy][xx]
+					if c == background || (!multi && c != color) {
+						continue
+					}
+					visited[yy][xx] = true
+					stack = append(stack, Pixel{C: c, X: xx, Y: yy})
+				}
+			}
+			minX, minY, maxX, maxY := object.I[0].X, object.I[0].Y, object.I[0].X, object.I[0].Y
+			for _, p := range object.I {
+				if p.X < minX {
+					minX = p.X
+				}
+				if p.Y < minY {
+					minY = p.Y
+				}
+				if p.X > maxX {
+					maxX = p.X
+				}
+				if p.Y > maxY {
+					maxY = p.Y
+				}
+			}
+			object.X, object.Y, object.W, object.H = minX, minY, maxX-minX+1, maxY-minY+1
+			object.Mask = make([][]bool, object.H)
+			for j := range object.Mask {
+				object.Mask[j] = make([]bool, object.W)
+			}
+			for _, p := range object.I {
+				object.Mask[p.Y-minY][p.X-minX] = true
+			}
+			for c, count := range object.Colors {
+				if count > object.Colors[object.Color] {
+					object.Color = uint8(c)
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
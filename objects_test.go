@@ -0,0 +1,106 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewImage(t *testing.T) {
+	grid := [][]byte{
+		{1, 2, 3},
+		{4, 5, 6},
+	}
+	image := NewImage(grid)
+	if image.W != 3 || image.H != 2 || len(image.I) != 6 {
+		t.Fatalf("%d by %d image with %d pixels", image.W, image.H, len(image.I))
+	}
+	if p := image.I[4]; p.C != 5 || p.X != 1 || p.Y != 1 {
+		t.Errorf("pixel 4 is %v", p)
+	}
+	if !reflect.DeepEqual(image.Grid(), grid) {
+		t.Errorf("the grid of the image is %v", image.Grid())
+	}
+}
+
+func TestBackground(t *testing.T) {
+	tests := []struct {
+		grid       [][]byte
+		background uint8
+	}{
+		{[][]byte{{0, 0}, {0, 3}}, 0},
+		{[][]byte{{7, 7, 2}, {7, 1, 2}}, 7},
+		// Ties go to the lowest color
+		{[][]byte{{4, 2}, {2, 4}}, 2},
+	}
+	for _, test := range tests {
+		if background := NewImage(test.grid).Background(); background != test.background {
+			t.Errorf("the background of %v is %d instead of %d", test.grid, background, test.background)
+		}
+	}
+}
+
+func TestObjects(t *testing.T) {
+	grid := [][]byte{
+		{1, 0, 0, 2},
+		{0, 1, 0, 2},
+		{0, 0, 0, 3},
+		{4, 4, 0, 0},
+	}
+	image := NewImage(grid)
+	sizes := func(objects []Object) []int {
+		result := make([]int, 0, len(objects))
+		for _, object := range objects {
+			result = append(result, object.Size())
+		}
+		return result
+	}
+
+	// Four connectivity splits the diagonal and the colors
+	four := image.Objects(0, false, false)
+	if !reflect.DeepEqual(sizes(four), []int{1, 2, 1, 1, 2}) {
+		t.Errorf("four connected sizes %v", sizes(four))
+	}
+	// Eight connectivity joins the diagonal
+	eight := image.Objects(0, true, false)
+	if !reflect.DeepEqual(sizes(eight), []int{2, 2, 1, 2}) {
+		t.Errorf("eight connected sizes %v", sizes(eight))
+	}
+	diagonal := eight[0]
+	if diagonal.Color != 1 || diagonal.X != 0 || diagonal.Y != 0 || diagonal.W != 2 || diagonal.H != 2 {
+		t.Errorf("diagonal object %+v", diagonal)
+	}
+	if !reflect.DeepEqual(diagonal.Mask, [][]bool{{true, false}, {false, true}}) {
+		t.Errorf("diagonal mask %v", diagonal.Mask)
+	}
+	if x, y := diagonal.Position(); x != .5 || y != .5 {
+		t.Errorf("diagonal position %f, %f", x, y)
+	}
+	// Multicolor joins the 2 and 3 column into one object of majority color 2
+	multi := image.Objects(0, false, true)
+	if !reflect.DeepEqual(sizes(multi), []int{1, 3, 1, 2}) {
+		t.Errorf("multicolor sizes %v", sizes(multi))
+	}
+	column := multi[1]
+	if column.Color != 2 || column.Colors[2] != 2 || column.Colors[3] != 1 || column.X != 3 || column.H != 3 {
+		t.Errorf("multicolor object %+v", column)
+	}
+
+	// With another background the former background is one large object
+	objects := image.Objects(4, false, false)
+	total := 0
+	for _, object := range objects {
+		for _, p := range object.I {
+			if p.C == 4 {
+				t.Errorf("background pixel %v in an object", p)
+			}
+		}
+		total += object.Size()
+	}
+	if total != 14 {
+		t.Errorf("%d pixels in objects instead of 14", total)
+	}
+}
@@ -0,0 +1,444 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pointlander/matrix"
+)
+
+// Optimizer is an optimizer of the cost of samples
+type Optimizer interface {
+	// Iterate runs one step of the optimizer and returns the best sample
+	Iterate(a ...matrix.Matrix) matrix.Sample
+}
+
+// NewOptimizer creates the optimizer selected by the optimizer flag, where n
+// and scale are the parameters of the sampling optimizer which also size the
+// populations and steps of the other optimizers
+func NewOptimizer(rng *matrix.Rand, n int, scale float64, vars int,
+	cost func(samples []matrix.Sample, a ...matrix.Matrix), a ...matrix.Matrix) Optimizer {
+	if *FlagOptimizer == "sampling" {
+		optimizer := matrix.NewOptimizer(rng, n, scale, vars, cost, a...)
+		return &optimizer
+	}
+	space := NewSpace(rng, vars, cost, a...)
+	switch *FlagOptimizer {
+	case "cmaes":
+		return NewCMAES(space, n*n)
+	case "ga":
+		return NewGA(space, n*n, scale)
+	case "spsa":
+		return NewSPSA(space, n*n/2, scale)
+	case "fd":
+		return NewFD(space, n*n/2, scale)
+	}
+	panic(fmt.Errorf("unknown optimizer %s, expected one of sampling, cmaes, ga, spsa, fd", *FlagOptimizer))
+}
+
+// Space is the flattened parameter space of the variables of an optimization
+type Space struct {
+	Rng    *matrix.Rand
+	Shapes []matrix.Matrix
+	Zeros  []matrix.RandomMatrix
+	Cost   func(samples []matrix.Sample, a ...matrix.Matrix)
+	// StdDev is the standard deviation of the prior of each parameter
+	StdDev []float64
+}
+
+// NewSpace creates a new parameter space with the shapes of the variables
+func NewSpace(rng *matrix.Rand, vars int, cost func(samples []matrix.Sample, a ...matrix.Matrix), a ...matrix.Matrix) Space {
+	space := Space{
+		Rng:  rng,
+		Cost: cost,
+	}
+	for v := 0; v < vars; v++ {
+		shape := a[0]
+		if len(a) > 1 {
+			shape = a[v]
+		}
+		space.Shapes = append(space.Shapes, matrix.NewCoord(shape.Cols, shape.Rows))
+		space.Zeros = append(space.Zeros, matrix.RandomMatrix{
+			Cols: shape.Cols,
+			Rows: shape.Rows,
+			Data: make([]matrix.Random, shape.Cols*shape.Rows),
+		})
+		factor := math.Sqrt(2.0 / float64(shape.Cols))
+		for i := 0; i < shape.Cols*shape.Rows; i++ {
+			space.StdDev = append(space.StdDev, factor)
+		}
+	}
+	return space
+}
+
+// Size is the number of parameters
+func (s Space) Size() int {
+	return len(s.StdDev)
+}
+
+// Init samples parameters from the prior
+func (s Space) Init() []float32 {
+	theta := make([]float32, s.Size())
+	for i := range theta {
+		theta[i] = float32(s.Rng.NormFloat64() * s.StdDev[i])
+	}
+	return theta
+}
+
+// Sample creates a deterministic sample with the parameters as the x variables
+// and zero y and z variables, so that x + y*z is the parameters
+func (s Space) Sample(theta []float32) matrix.Sample {
+	sample := matrix.Sample{
+		Vars: make([][3]matrix.Generator, len(s.Shapes)),
+	}
+	index := 0
+	for v, shape := range s.Shapes {
+		x := matrix.RandomMatrix{
+			Cols: shape.Cols,
+			Rows: shape.Rows,
+			Data: make([]matrix.Random, shape.Cols*shape.Rows),
+		}
+		for i := range x.Data {
+			x.Data[i].Mean = float64(theta[index])
+			index++
+		}
+		sample.Vars[v][0] = matrix.Generator{Distribution: x, Seed: 1}
+		sample.Vars[v][1] = matrix.Generator{Distribution: s.Zeros[v], Seed: 1}
+		sample.Vars[v][2] = matrix.Generator{Distribution: s.Zeros[v], Seed: 1}
+	}
+	return sample
+}
+
+// Evaluate computes the costs of the parameters in chunks to bound the memory of the samples
+func (s Space) Evaluate(thetas [][]float32, a ...matrix.Matrix) []float64 {
+	const chunk = 32
+	costs := make([]float64, 0, len(thetas))
+	for i := 0; i < len(thetas); i += chunk {
+		samples := make([]matrix.Sample, 0, chunk)
+		for _, theta := range thetas[i:min(i+chunk, len(thetas))] {
+			samples = append(samples, s.Sample(theta))
+		}
+		s.Cost(samples, a...)
+		for _, sample := range samples {
+			costs = append(costs, sample.Cost)
+		}
+	}
+	return costs
+}
+
+// CMAES is the separable covariance matrix adaptation evolution strategy, which
+// adapts a diagonal covariance so that it scales to many parameters
+type CMAES struct {
+	Space
+	Lambda  int
+	Mu      int
+	Weights []float64
+	Mueff   float64
+	Cs      float64
+	Ds      float64
+	Cc      float64
+	C1      float64
+	Cmu     float64
+	ChiN    float64
+	Mean    []float64
+	C       []float64
+	Ps      []float64
+	Pc      []float64
+	Sigma   float64
+	Count   int
+}
+
+// NewCMAES creates a new separable CMA-ES with a population of lambda
+func NewCMAES(space Space, lambda int) *CMAES {
+	if lambda < 4 {
+		lambda = 4
+	}
+	n := float64(space.Size())
+	c := CMAES{
+		Space:  space,
+		Lambda: lambda,
+		Mu:     lambda / 2,
+		Sigma:  1,
+	}
+	sum, squares := 0.0, 0.0
+	for i := 0; i < c.Mu; i++ {
+		weight := math.Log(float64(c.Mu)+.5) - math.Log(float64(i+1))
+		c.Weights = append(c.Weights, weight)
+		sum += weight
+	}
+	for i := range c.Weights {
+		c.Weights[i] /= sum
+		squares += c.Weights[i] * c.Weights[i]
+	}
+	c.Mueff = 1 / squares
+	c.Cs = (c.Mueff + 2) / (n + c.Mueff + 5)
+	c.Ds = 1 + 2*math.Max(0, math.Sqrt((c.Mueff-1)/(n+1))-1) + c.Cs
+	c.Cc = (4 + c.Mueff/n) / (n + 4 + 2*c.Mueff/n)
+	c.C1 = 2 / ((n+1.3)*(n+1.3) + c.Mueff)
+	c.Cmu = math.Min(1-c.C1, 2*(c.Mueff-2+1/c.Mueff)/((n+2)*(n+2)+c.Mueff))
+	c.C1 *= (n + 2) / 3
+	c.Cmu *= (n + 2) / 3
+	if c.C1+c.Cmu > 1 {
+		scale := 1 / (c.C1 + c.Cmu)
+		c.C1, c.Cmu = c.C1*scale, c.Cmu*scale
+	}
+	c.ChiN = math.Sqrt(n) * (1 - 1/(4*n) + 1/(21*n*n))
+	for i, value := range space.Init() {
+		c.Mean = append(c.Mean, float64(value))
+		c.C = append(c.C, space.StdDev[i]*space.StdDev[i])
+	}
+	c.Ps = make([]float64, space.Size())
+	c.Pc = make([]float64, space.Size())
+	return &c
+}
+
+// Iterate samples and ranks a population and adapts the distribution
+func (c *CMAES) Iterate(a ...matrix.Matrix) matrix.Sample {
+	n := c.Size()
+	z, thetas := make([][]float32, c.Lambda), make([][]float32, c.Lambda)
+	for k := range thetas {
+		z[k], thetas[k] = make([]float32, n), make([]float32, n)
+		for i := range thetas[k] {
+			z[k][i] = float32(c.Rng.NormFloat64())
+			thetas[k][i] = float32(c.Mean[i] + c.Sigma*math.Sqrt(c.C[i])*float64(z[k][i]))
+		}
+	}
+	costs := c.Evaluate(thetas, a...)
+	rank := make([]int, c.Lambda)
+	for k := range rank {
+		rank[k] = k
+	}
+	sort.Slice(rank, func(i, j int) bool {
+		return costs[rank[i]] < costs[rank[j]]
+	})
+	c.Count++
+
+	zw, yw := make([]float64, n), make([]float64, n)
+	for k, weight := range c.Weights {
+		for i, value := range z[rank[k]] {
+			zw[i] += weight * float64(value)
+		}
+	}
+	norm := 0.0
+	for i := range c.Ps {
+		yw[i] = math.Sqrt(c.C[i]) * zw[i]
+		c.Mean[i] += c.Sigma * yw[i]
+		c.Ps[i] = (1-c.Cs)*c.Ps[i] + math.Sqrt(c.Cs*(2-c.Cs)*c.Mueff)*zw[i]
+		norm += c.Ps[i] * c.Ps[i]
+	}
+	norm = math.Sqrt(norm)
+	hsig := 0.0
+	if norm/math.Sqrt(1-math.Pow(1-c.Cs, float64(2*c.Count)))/c.ChiN < 1.4+2/(float64(n)+1) {
+		hsig = 1
+	}
+	for i := range c.C {
+		c.Pc[i] = (1-c.Cc)*c.Pc[i] + hsig*math.Sqrt(c.Cc*(2-c.Cc)*c.Mueff)*yw[i]
+		rankMu := 0.0
+		for k, weight := range c.Weights {
+			y := math.Sqrt(c.C[i]) * float64(z[rank[k]][i])
+			rankMu += weight * y * y
+		}
+		c.C[i] = (1-c.C1-c.Cmu)*c.C[i] +
+			c.C1*(c.Pc[i]*c.Pc[i]+(1-hsig)*c.Cc*(2-c.Cc)*c.C[i]) +
+			c.Cmu*rankMu
+	}
+	c.Sigma *= math.Exp((c.Cs / c.Ds) * (norm/c.ChiN - 1))
+
+	best := c.Sample(thetas[rank[0]])
+	best.Cost = costs[rank[0]]
+	return best
+}
+
+// GA is a genetic algorithm with elitism, tournament selection, uniform crossover and gaussian mutation
+type GA struct {
+	Space
+	Population [][]float32
+	Costs      []float64
+	Elites     int
+	Rate       float64
+}
+
+// NewGA creates a new genetic algorithm with a population of size mutating genes at rate
+func NewGA(space Space, size int, rate float64) *GA {
+	if size < 4 {
+		size = 4
+	}
+	g := GA{
+		Space:  space,
+		Elites: max(1, size/10),
+		Rate:   rate,
+	}
+	for i := 0; i < size; i++ {
+		g.Population = append(g.Population, space.Init())
+	}
+	return &g
+}
+
+// Iterate breeds the next generation and returns the best individual
+func (g *GA) Iterate(a ...matrix.Matrix) matrix.Sample {
+	if g.Costs == nil {
+		g.Costs = g.Evaluate(g.Population, a...)
+	} else {
+		tournament := func() []float32 {
+			best := int(g.Rng.Uint32() % uint32(len(g.Population)))
+			for i := 0; i < 2; i++ {
+				j := int(g.Rng.Uint32() % uint32(len(g.Population)))
+				if g.Costs[j] < g.Costs[best] {
+					best = j
+				}
+			}
+			return g.Population[best]
+		}
+		children := make([][]float32, len(g.Population)-g.Elites)
+		for k := range children {
+			x, y := tournament(), tournament()
+			child := make([]float32, len(x))
+			for i := range child {
+				if g.Rng.Uint32()&1 == 0 {
+					child[i] = x[i]
+				} else {
+					child[i] = y[i]
+				}
+				if g.Rng.Float64() < g.Rate {
+					child[i] += float32(g.Rng.NormFloat64() * g.StdDev[i])
+				}
+			}
+			children[k] = child
+		}
+		costs := g.Evaluate(children, a...)
+		g.Population = append(g.Population[:g.Elites], children...)
+		g.Costs = append(g.Costs[:g.Elites], costs...)
+	}
+	rank := make([]int, len(g.Population))
+	for k := range rank {
+		rank[k] = k
+	}
+	sort.Slice(rank, func(i, j int) bool {
+		return g.Costs[rank[i]] < g.Costs[rank[j]]
+	})
+	population, costs := make([][]float32, len(rank)), make([]float64, len(rank))
+	for k, r := range rank {
+		population[k], costs[k] = g.Population[r], g.Costs[r]
+	}
+	g.Population, g.Costs = population, costs
+
+	best := g.Sample(g.Population[0])
+	best.Cost = g.Costs[0]
+	return best
+}
+
+// SPSA is simultaneous perturbation stochastic approximation, which estimates the
+// gradient from pairs of random perturbations of all of the parameters
+type SPSA struct {
+	Space
+	Theta []float32
+	Pairs int
+	A     float64
+	C     float64
+	Count int
+}
+
+// NewSPSA creates a new SPSA optimizer averaging pairs perturbations with gain scale
+func NewSPSA(space Space, pairs int, scale float64) *SPSA {
+	return &SPSA{
+		Space: space,
+		Theta: space.Init(),
+		Pairs: max(1, pairs),
+		A:     scale,
+		C:     scale,
+	}
+}
+
+// Iterate estimates the gradient and takes a step, returning the sample before the step
+func (s *SPSA) Iterate(a ...matrix.Matrix) matrix.Sample {
+	ak := s.A / math.Pow(float64(s.Count+1+10), .602)
+	ck := s.C / math.Pow(float64(s.Count+1), .101)
+	s.Count++
+	deltas := make([][]float32, s.Pairs)
+	thetas := [][]float32{s.Theta}
+	for p := range deltas {
+		deltas[p] = make([]float32, len(s.Theta))
+		plus, minus := make([]float32, len(s.Theta)), make([]float32, len(s.Theta))
+		for i := range deltas[p] {
+			deltas[p][i] = 1
+			if s.Rng.Uint32()&1 == 0 {
+				deltas[p][i] = -1
+			}
+			step := float32(ck * s.StdDev[i] * float64(deltas[p][i]))
+			plus[i], minus[i] = s.Theta[i]+step, s.Theta[i]-step
+		}
+		thetas = append(thetas, plus, minus)
+	}
+	costs := s.Evaluate(thetas, a...)
+	sample := s.Sample(s.Theta)
+	sample.Cost = costs[0]
+
+	theta := make([]float32, len(s.Theta))
+	copy(theta, s.Theta)
+	for p, delta := range deltas {
+		diff := (costs[1+2*p] - costs[2+2*p]) / (2 * ck * float64(s.Pairs))
+		for i, d := range delta {
+			theta[i] -= float32(ak * diff * float64(d) * s.StdDev[i])
+		}
+	}
+	s.Theta = theta
+	return sample
+}
+
+// FD is a finite difference optimizer, which estimates the gradient with
+// central differences of a random subset of the parameters each step
+type FD struct {
+	Space
+	Theta  []float32
+	Coords int
+	A      float64
+	H      float64
+	Count  int
+}
+
+// NewFD creates a new finite difference optimizer of coords parameters per step with gain scale
+func NewFD(space Space, coords int, scale float64) *FD {
+	return &FD{
+		Space:  space,
+		Theta:  space.Init(),
+		Coords: max(1, coords),
+		A:      scale,
+		H:      scale,
+	}
+}
+
+// Iterate estimates the partial derivatives of random parameters and takes a step,
+// returning the sample before the step
+func (f *FD) Iterate(a ...matrix.Matrix) matrix.Sample {
+	ak := f.A / math.Pow(float64(f.Count+1+10), .602)
+	f.Count++
+	coords := make([]int, f.Coords)
+	thetas := [][]float32{f.Theta}
+	for k := range coords {
+		coords[k] = int(f.Rng.Uint32() % uint32(len(f.Theta)))
+		i := coords[k]
+		plus, minus := make([]float32, len(f.Theta)), make([]float32, len(f.Theta))
+		copy(plus, f.Theta)
+		copy(minus, f.Theta)
+		plus[i] += float32(f.H * f.StdDev[i])
+		minus[i] -= float32(f.H * f.StdDev[i])
+		thetas = append(thetas, plus, minus)
+	}
+	costs := f.Evaluate(thetas, a...)
+	sample := f.Sample(f.Theta)
+	sample.Cost = costs[0]
+
+	theta := make([]float32, len(f.Theta))
+	copy(theta, f.Theta)
+	for k, i := range coords {
+		diff := (costs[1+2*k] - costs[2+2*k]) / (2 * f.H)
+		theta[i] -= float32(ak * diff * f.StdDev[i])
+	}
+	f.Theta = theta
+	return sample
+}
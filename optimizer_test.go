@@ -0,0 +1,100 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/pointlander/matrix"
+)
+
+// quadratic is the squared distance of the first variable from target
+func quadratic(target []float32) func(samples []matrix.Sample, a ...matrix.Matrix) {
+	return func(samples []matrix.Sample, a ...matrix.Matrix) {
+		for i := range samples {
+			x := samples[i].Vars[0][0].Sample()
+			y := samples[i].Vars[0][1].Sample()
+			z := samples[i].Vars[0][2].Sample()
+			w := x.Add(y.H(z))
+			cost := 0.0
+			for j, value := range w.Data {
+				diff := float64(value - target[j])
+				cost += diff * diff
+			}
+			samples[i].Cost = cost
+		}
+	}
+}
+
+// testOptimizer runs the optimizer of the optimizer flag on a quadratic, returning
+// the optimizer, the cost of the first iteration and the cost of the last iteration
+func testOptimizer(t *testing.T, name string, iterations int) (Optimizer, float64, float64) {
+	t.Helper()
+	defer func(name string) {
+		*FlagOptimizer = name
+	}(*FlagOptimizer)
+	*FlagOptimizer = name
+	rng := matrix.Rand(1)
+	target := []float32{1, -.5, .25, 2}
+	optimizer := NewOptimizer(&rng, 9, .1, 1, quadratic(target), matrix.NewCoord(4, 1))
+	first := optimizer.Iterate().Cost
+	last := first
+	for i := 1; i < iterations; i++ {
+		last = optimizer.Iterate().Cost
+	}
+	return optimizer, first, last
+}
+
+func TestOptimizers(t *testing.T) {
+	tests := []struct {
+		name       string
+		iterations int
+		cost       float64
+	}{
+		{"cmaes", 60, 1e-6},
+		{"ga", 300, 1e-2},
+		// The gains of spsa decay, so that it converges slowly
+		{"spsa", 1000, 5e-2},
+		{"fd", 100, 1e-4},
+	}
+	for _, test := range tests {
+		_, first, last := testOptimizer(t, test.name, test.iterations)
+		if last > test.cost || last > first {
+			t.Errorf("%s reduced the cost from %f to %f, expected less than %f", test.name, first, last, test.cost)
+		}
+	}
+}
+
+func TestNewOptimizer(t *testing.T) {
+	for _, name := range []string{"sampling", "cmaes", "ga", "spsa", "fd"} {
+		optimizer, _, _ := testOptimizer(t, name, 1)
+		var ok bool
+		switch name {
+		case "sampling":
+			_, ok = optimizer.(*matrix.Optimizer)
+		case "cmaes":
+			_, ok = optimizer.(*CMAES)
+		case "ga":
+			_, ok = optimizer.(*GA)
+		case "spsa":
+			_, ok = optimizer.(*SPSA)
+		case "fd":
+			_, ok = optimizer.(*FD)
+		}
+		if !ok {
+			t.Errorf("%s created a %T", name, optimizer)
+		}
+	}
+
+	defer func(name string) {
+		*FlagOptimizer = name
+		if recover() == nil {
+			t.Error("an unknown optimizer did not panic")
+		}
+	}(*FlagOptimizer)
+	*FlagOptimizer = "adam"
+	rng := matrix.Rand(1)
+	NewOptimizer(&rng, 9, .1, 1, quadratic([]float32{0}), matrix.NewCoord(1, 1))
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+)
+
+// Probability is the softmax probability of a color given the signals of the colors
+func Probability(signals []float32, color int) float32 {
+	maxSignal := signals[0]
+	for _, value := range signals {
+		if value > maxSignal {
+			maxSignal = value
+		}
+	}
+	sum := 0.0
+	for _, value := range signals {
+		sum += math.Exp(float64(value - maxSignal))
+	}
+	return float32(math.Exp(float64(signals[color]-maxSignal)) / sum)
+}
+
+// Prediction is a predicted output grid for a test input
+type Prediction struct {
+	Grid       [][]byte
+	Confidence [][]float32
+	Cost       float64
+}
+
+// NewInput creates a pair from an input grid with an unknown w by h output
+func NewInput(class int, input [][]byte, w, h int) Pair {
+	pair := Pair{
+		Class: class,
+		Input: Image{
+			W: len(input[0]),
+			H: len(input),
+		},
+		Output: Image{
+			W: w,
+			H: h,
+		},
+	}
+	for j, v := range input {
+		for i := range v {
+			pair.Input.I = append(pair.Input.I, Pixel{
+				C: v[i],
+				X: i,
+				Y: j,
+			})
+		}
+	}
+	return pair
+}
+
+// PredictSize predicts the size of the output for an input from the train pairs
+func PredictSize(train []Pair, input Image) (w, h int) {
+	same, fixed, scaled := true, true, true
+	for _, pair := range train {
+		if pair.Output.W != pair.Input.W || pair.Output.H != pair.Input.H {
+			same = false
+		}
+		if pair.Output.W != train[0].Output.W || pair.Output.H != train[0].Output.H {
+			fixed = false
+		}
+		if pair.Output.W*train[0].Input.W != train[0].Output.W*pair.Input.W ||
+			pair.Output.H*train[0].Input.H != train[0].Output.H*pair.Input.H {
+			scaled = false
+		}
+	}
+	switch {
+	case len(train) == 0 || same:
+		w, h = input.W, input.H
+	case fixed:
+		w, h = train[0].Output.W, train[0].Output.H
+	case scaled:
+		w = input.W * train[0].Output.W / train[0].Input.W
+		h = input.H * train[0].Output.H / train[0].Input.H
+	default:
+		w, h = input.W, input.H
+	}
+	clamp := func(value int) int {
+		if value < 1 {
+			return 1
+		} else if value > 30 {
+			return 30
+		}
+		return value
+	}
+	return clamp(w), clamp(h)
+}
+
+// Predictor predicts the outputs of the test inputs of a set
+type Predictor func(set Set, seed uint32) []Prediction
+
+// predict builds the optimizations for each test input of a set from the train pairs
+// and a predicted output size, and solves them without looking at the test outputs
+func predict(set Set, solve func(opt []Opt, w, h int) Prediction) []Prediction {
+	train := make([]Pair, 0, 8)
+	for _, t := range set.Train {
+		train = append(train, NewPair(0, t))
+	}
+	predictions := make([]Prediction, len(set.Test))
+	for i, t := range set.Test {
+		input := NewInput(0, t.Input, 0, 0)
+		input.Output.W, input.Output.H = PredictSize(train, input.Input)
+		predictions[i] = solve(NewOpts(train, input), input.Output.W, input.Output.H)
+	}
+	return predictions
+}
+
+// Predict trains an autocoder on the train pairs and the test inputs of a set and
+// decodes a prediction for each test input without looking at the test outputs
+func Predict(set Set, seed uint32) []Prediction {
+	return predict(set, func(opt []Opt, w, h int) (prediction Prediction) {
+		sample := TrainAC(seed, [][]Opt{opt}, nil)
+		prediction.Cost = sample.Cost
+		prediction.Grid, prediction.Confidence = DecodeAC(sample, 0, w, h)
+		return prediction
+	})
+}
+
+// PredictSA trains a self attention model on the train pairs and the test inputs of a set
+// and decodes a prediction for each test input without looking at the test outputs
+func PredictSA(set Set, seed uint32) []Prediction {
+	return predict(set, func(opt []Opt, w, h int) (prediction Prediction) {
+		sample := TrainSA(seed, opt, nil)
+		prediction.Cost = sample.Cost
+		prediction.Grid, prediction.Confidence = DecodeSA(sample, w, h)
+		return prediction
+	})
+}
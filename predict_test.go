@@ -0,0 +1,55 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pointlander/frozenstar/truth"
+)
+
+// TestTruthUnused checks that building the training data and predicting never score the sealed test outputs
+func TestTruthUnused(t *testing.T) {
+	data := `{
+		"train": [
+			{"input": [[1, 0], [0, 1]], "output": [[0, 1], [1, 0]]},
+			{"input": [[2, 2], [0, 0]], "output": [[0, 0], [2, 2]]}
+		],
+		"test": [
+			{"input": [[3, 0], [3, 0]], "output": [[0, 3], [0, 3]]}
+		]
+	}`
+	var set Set
+	if err := json.Unmarshal([]byte(data), &set); err != nil {
+		t.Fatal(err)
+	}
+	sets := []Set{set}
+
+	before := truth.Scores()
+	GetTrainingData(sets, 0, 0)
+	GetObjectTrainingData(sets, 0, 0)
+	// The solvers of Predict and PredictSA only receive the optimizations built by predict
+	solve := func(opt []Opt, w, h int) Prediction {
+		if len(opt) == 0 || w != 2 || h != 2 {
+			t.Errorf("%d optimizations for a %d by %d output", len(opt), w, h)
+		}
+		return Prediction{Grid: [][]byte{{0, 0}, {0, 0}}}
+	}
+	predict(set, solve)
+	Validate(sets, 0, func(set Set, seed uint32) []Prediction {
+		return predict(set, solve)
+	}, 1)
+	if scores := truth.Scores() - before; scores != 0 {
+		t.Errorf("the test outputs were scored %d times", scores)
+	}
+
+	if _, exact := set.Test[0].Output.Score([][]byte{{0, 3}, {0, 3}}); !exact {
+		t.Error("the sealed test output does not match")
+	}
+	if scores := truth.Scores() - before; scores != 1 {
+		t.Errorf("the test outputs were scored %d times instead of once", scores)
+	}
+}
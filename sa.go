@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"sort"
 
+	"github.com/pointlander/frozenstar/autodiff"
 	"github.com/pointlander/matrix"
 )
 
@@ -26,81 +27,114 @@ func (o Opt) TargetOffset() int {
 
 // TargetSize is the size of the target
 func (o Opt) TargetSize() int {
-	return len(o.Output.Output.I)
+	return o.Output.Output.W * o.Output.Output.H
 }
 
-// GetTrainingData gets the training data
-func GetTrainingData(sets []Set, s, t int) (opt []Opt) {
-	train, test := make([]Pair, 0, 8), make([]Pair, 0, 8)
-	set := sets[s]
-	for _, t := range set.Train {
-		pair := Pair{
-			Class: s,
-			Input: Image{
-				W: len(t.Input[0]),
-				H: len(t.Input),
-			},
-			Output: Image{
-				W: len(t.Output[0]),
-				H: len(t.Output),
-			},
-		}
-		for j, v := range t.Input {
-			for i := range v {
-				pair.Input.I = append(pair.Input.I, Pixel{
-					C: v[i],
-					X: i,
-					Y: j,
-				})
-			}
-		}
-		for j, v := range t.Output {
-			for i := range v {
-				pair.Output.I = append(pair.Output.I, Pixel{
-					C: v[i],
-					X: i,
-					Y: j,
-				})
+// Tokens returns the rows of pixel tokens of the optimization
+func (o Opt) Tokens() Tokens {
+	return Tokens{
+		Opt:     o.Opt,
+		Output:  len(o.Input.Input.I),
+		Outputs: len(o.Input.Output.I),
+		Offset:  o.TargetOffset(),
+		Size:    o.TargetSize(),
+	}
+}
+
+// Tokens are the rows of tokens of an optimization
+type Tokens struct {
+	Opt matrix.Matrix
+	// Output is the first row of the output of the train pair and Outputs is its number of rows
+	Output, Outputs int
+	// Offset is the first row of the target and Size is its number of rows
+	Offset, Size int
+}
+
+// CopyTokens copies the tokens of the optimizations
+func CopyTokens(tokens []Tokens) []Tokens {
+	cp := make([]Tokens, len(tokens))
+	copy(cp, tokens)
+	for i := range cp {
+		cp[i].Opt.Data = make([]float32, len(tokens[i].Opt.Data))
+		copy(cp[i].Opt.Data, tokens[i].Opt.Data)
+	}
+	return cp
+}
+
+// Encoding is an encoding of the rows of optimizations into tokens
+type Encoding struct {
+	// Width is the size of a token
+	Width int
+	// Fill fills a target token from a row of parameters
+	Fill func(token, params []float32)
+	// Soft is the target tokens of rows of parameters with softmaxes instead of argmaxes,
+	// so that gradients reach the parameters
+	Soft func(t *autodiff.Tape, params *autodiff.Value) *autodiff.Value
+}
+
+// PixelTokens is the encoding of pixels into tokens of a color, a position and the output flag
+var PixelTokens = Encoding{
+	Width: Input,
+	Fill:  FillPixel,
+	Soft: func(t *autodiff.Tape, params *autodiff.Value) *autodiff.Value {
+		return t.Softmax(params, 10, 30, 30, 1)
+	},
+}
+
+// FillPixel fills a target pixel token from a row of parameters
+func FillPixel(token, params []float32) {
+	for _, offset := range [...][2]int{{0, 10}, {10, 30}, {10 + 30, 30}} {
+		max, index := float32(0.0), 0
+		for key, value := range params[offset[0] : offset[0]+offset[1]] {
+			if value > max {
+				index, max = key, value
 			}
 		}
-		train = append(train, pair)
+		token[offset[0]+index] = 1
 	}
-	for _, t := range set.Test {
-		pair := Pair{
-			Class: s,
-			Input: Image{
-				W: len(t.Input[0]),
-				H: len(t.Input),
-			},
-			Output: Image{
-				W: len(t.Output[0]),
-				H: len(t.Output),
-			},
-		}
-		for j, v := range t.Input {
-			for i := range v {
-				pair.Input.I = append(pair.Input.I, Pixel{
-					C: v[i],
-					X: i,
-					Y: j,
-				})
-			}
+	token[10+30+30] = 1
+}
+
+// NewPair creates a pair from an example
+func NewPair(class int, example Example) Pair {
+	pair := Pair{
+		Class: class,
+		Input: Image{
+			W: len(example.Input[0]),
+			H: len(example.Input),
+		},
+		Output: Image{
+			W: len(example.Output[0]),
+			H: len(example.Output),
+		},
+	}
+	for j, v := range example.Input {
+		for i := range v {
+			pair.Input.I = append(pair.Input.I, Pixel{
+				C: v[i],
+				X: i,
+				Y: j,
+			})
 		}
-		for j, v := range t.Output {
-			for i := range v {
-				pair.Output.I = append(pair.Output.I, Pixel{
-					C: v[i],
-					X: i,
-					Y: j,
-				})
-			}
+	}
+	for j, v := range example.Output {
+		for i := range v {
+			pair.Output.I = append(pair.Output.I, Pixel{
+				C: v[i],
+				X: i,
+				Y: j,
+			})
 		}
-		test = append(test, pair)
 	}
+	return pair
+}
+
+// NewOpts creates the optimizations for predicting the output of test from train
+func NewOpts(train []Pair, test Pair) (opt []Opt) {
 	opt = make([]Opt, len(train))
 	for i := range opt {
 		opt[i].Input = train[i]
-		opt[i].Output = test[t]
+		opt[i].Output = test
 		opt[i].Opt = matrix.NewZeroMatrix(Input, opt[i].TargetOffset()+opt[i].TargetSize())
 	}
 	for i, pair := range train {
@@ -119,7 +153,7 @@ func GetTrainingData(sets []Set, s, t int) (opt []Opt) {
 			index += Input
 		}
 
-		for _, p := range test[t].Input.I {
+		for _, p := range test.Input.I {
 			opt[i].Opt.Data[index+int(p.C)] = 1
 			opt[i].Opt.Data[index+10+p.X] = 1
 			opt[i].Opt.Data[index+10+30+p.Y] = 1
@@ -129,14 +163,52 @@ func GetTrainingData(sets []Set, s, t int) (opt []Opt) {
 	return opt
 }
 
-// SA is self attention mode
-func SA() {
-	rng := matrix.Rand(1)
+// Copy copies the optimizations
+func Copy(opt []Opt) []Opt {
+	cp := make([]Opt, len(opt))
+	copy(cp, opt)
+	for i := range cp {
+		cp[i].Opt.Data = make([]float32, len(opt[i].Opt.Data))
+		copy(cp[i].Opt.Data, opt[i].Opt.Data)
+	}
+	return cp
+}
+
+// GetTrainingData gets the training data
+func GetTrainingData(sets []Set, s, t int) (opt []Opt) {
+	train := make([]Pair, 0, 8)
+	set := sets[s]
+	for _, t := range set.Train {
+		train = append(train, NewPair(s, t))
+	}
+	test := NewInput(s, set.Test[t].Input, 0, 0)
+	test.Output.W, test.Output.H = PredictSize(train, test.Input)
+	return NewOpts(train, test)
+}
+
+// TrainSA trains a self attention model on the optimizations of a set, calling
+// iteration with the best sample after each step of the optimizer
+func TrainSA(seed uint32, source []Opt, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	tokens := make([]Tokens, len(source))
+	for i := range source {
+		tokens[i] = source[i].Tokens()
+	}
+	return TrainSATokens(seed, PixelTokens, tokens, iteration)
+}
+
+// TrainSATokens trains a self attention model on the tokens of the optimizations of a set
+// in the given encoding, calling iteration with the best sample after each step of the optimizer
+func TrainSATokens(seed uint32, encoding Encoding, source []Tokens, iteration func(i int, sample matrix.Sample)) matrix.Sample {
+	if *FlagGradient {
+		return TrainSAGradient(seed, encoding, source, iteration)
+	}
+	rng := matrix.Rand(seed)
+	cost := NewCost("entropy")
+	width := encoding.Width
 
-	sets := Load()
 	done := make(chan bool, 8)
 	process := func(sample *matrix.Sample) {
-		opt := GetTrainingData(sets, 0, 0)
+		opt := CopyTokens(source)
 		x1 := sample.Vars[0][0].Sample()
 		y1 := sample.Vars[0][1].Sample()
 		z1 := sample.Vars[0][2].Sample()
@@ -162,53 +234,27 @@ func SA() {
 		z6 := sample.Vars[5][2].Sample()
 		b2 := x6.Add(y6.H(z6))
 		for j := range opt {
-			offset := len(opt[j].Input.Input.I) + len(opt[j].Input.Output.I) + len(opt[j].Output.Input.I)
 			for k := 0; k < w1.Rows; k++ {
-				offset := offset + k
-				w1Offset := Input * k
-				cc := opt[j].Opt.Data[Input*offset : Input*offset+10]
-				w1CC := w1.Data[w1Offset : w1Offset+10]
-				maxCC, indexCC := float32(0.0), 0
-				for key, value := range w1CC {
-					if value > maxCC {
-						indexCC, maxCC = key, value
-					}
-				}
-				xx := opt[j].Opt.Data[Input*offset+10 : Input*offset+10+30]
-				w1XX := w1.Data[w1Offset+10 : w1Offset+10+30]
-				maxXX, indexXX := float32(0.0), 0
-				for key, value := range w1XX {
-					if value > maxXX {
-						indexXX, maxXX = key, value
-					}
-				}
-				yy := opt[j].Opt.Data[Input*offset+10+30 : Input*offset+10+30+30]
-				w1YY := w1.Data[w1Offset+10+30 : w1Offset+10+30+30]
-				maxYY, indexYY := float32(0.0), 0
-				for key, value := range w1YY {
-					if value > maxYY {
-						indexYY, maxYY = key, value
-					}
-				}
-				cc[indexCC] = 1
-				xx[indexXX] = 1
-				yy[indexYY] = 1
-				opt[j].Opt.Data[Input*offset+10+30+30] = 1
+				row := width * (opt[j].Offset + k)
+				encoding.Fill(opt[j].Opt.Data[row:row+width], w1.Data[width*k:width*(k+1)])
 			}
 		}
-		sum := 0.0
+		traces := make([]Trace, len(opt))
 		for i := range opt {
 			output := w2.MulT(opt[i].Opt).Add(b2).Sigmoid()
-			entropy := matrix.SelfEntropy64(q.MulT(output), k.MulT(output), v.MulT(output))
-			for _, e := range entropy {
-				sum += e
+			traces[i] = Trace{
+				Opt:            opt[i],
+				Hidden:         output,
+				Reconstruction: output,
+				Q:              q,
+				K:              k,
+				V:              v,
 			}
 		}
-		sample.Cost = sum
+		sample.Cost = cost(traces)
 		done <- true
 	}
-	opt := GetTrainingData(sets, 0, 0)
-	optimizer := matrix.NewOptimizer(&rng, 9, .1, 6, func(samples []matrix.Sample, x ...matrix.Matrix) {
+	optimizer := NewOptimizer(&rng, 9, .1, 6, func(samples []matrix.Sample, x ...matrix.Matrix) {
 		index, flight, cpus := 0, 0, runtime.NumCPU()
 		for flight < cpus && index < len(samples) {
 			go process(&samples[index])
@@ -229,147 +275,164 @@ func SA() {
 			fmt.Printf(".")
 		}
 		fmt.Printf("\n")
-	}, matrix.NewCoord(Input, opt[0].TargetSize()),
-		matrix.NewCoord(Input, 2*Input), matrix.NewCoord(Input, 2*Input), matrix.NewCoord(Input, 2*Input),
-		matrix.NewCoord(Input, Input), matrix.NewCoord(Input, 1))
-	w, h := opt[0].Output.Output.W, opt[0].Output.Output.H
+	}, matrix.NewCoord(width, source[0].Size),
+		matrix.NewCoord(width, 2*width), matrix.NewCoord(width, 2*width), matrix.NewCoord(width, 2*width),
+		matrix.NewCoord(width, width), matrix.NewCoord(width, 1))
+	budget := NewBudget(33)
 	var sample matrix.Sample
-	for i := 0; i < 33; i++ {
+	for i := 0; budget.Next(i); i++ {
 		sample = optimizer.Iterate()
 		fmt.Println(i, sample.Cost)
-		cost := sample.Cost
-		type Coord struct {
-			Signal float32
-			Coord  int
+		if iteration != nil {
+			iteration(i, sample)
 		}
-		type Result struct {
-			Color  byte
-			Signal float32
-			IX     int
-			IY     int
-			X      []Coord
-			Y      []Coord
-		}
-		grid := make([][]Result, h)
-		for j := range grid {
-			grid[j] = make([]Result, w)
+		if budget.Stop(sample.Cost, false) {
+			break
 		}
-		x1 := sample.Vars[0][0].Sample()
-		y1 := sample.Vars[0][1].Sample()
-		z1 := sample.Vars[0][2].Sample()
-		w1 := x1.Add(y1.H(z1))
-		for offset := 0; offset < len(w1.Data); offset += Input {
-			maxColor, color := float32(0.0), 0
-			cc := w1.Data[offset : offset+10]
-			for j := range cc {
-				for cc[j] > maxColor {
-					maxColor, color = cc[j], j
-				}
-			}
-			xx := w1.Data[offset+10 : offset+10+w]
-			x := make([]Coord, w)
-			for j, value := range xx {
-				x[j].Coord = j
-				x[j].Signal = value
-			}
-			sort.Slice(x, func(i, j int) bool {
-				return x[i].Signal > x[j].Signal
-			})
-			yy := w1.Data[offset+10+w : offset+10+w+h]
-			y := make([]Coord, h)
-			for j, value := range yy {
-				y[j].Coord = j
-				y[j].Signal = value
-			}
-			sort.Slice(y, func(i, j int) bool {
-				return y[i].Signal > y[j].Signal
-			})
-			result := Result{
-				Color:  byte(color),
-				Signal: maxColor,
-				IX:     0,
-				IY:     0,
-				X:      x,
-				Y:      y,
+	}
+	fmt.Println("stopped", budget.Reason)
+	return sample
+}
+
+// DecodeSA decodes the w by h target grid of a sample, returning the colors
+// and the softmax probability of the color of each cell
+func DecodeSA(sample matrix.Sample, w, h int) ([][]byte, [][]float32) {
+	type Coord struct {
+		Signal float32
+		Coord  int
+	}
+	type Result struct {
+		Color       byte
+		Signal      float32
+		Probability float32
+		IX          int
+		IY          int
+		X           []Coord
+		Y           []Coord
+	}
+	grid := make([][]Result, h)
+	for j := range grid {
+		grid[j] = make([]Result, w)
+	}
+	x1 := sample.Vars[0][0].Sample()
+	y1 := sample.Vars[0][1].Sample()
+	z1 := sample.Vars[0][2].Sample()
+	w1 := x1.Add(y1.H(z1))
+	for offset := 0; offset < len(w1.Data); offset += Input {
+		maxColor, color := float32(0.0), 0
+		cc := w1.Data[offset : offset+10]
+		for j := range cc {
+			for cc[j] > maxColor {
+				maxColor, color = cc[j], j
 			}
+		}
+		xx := w1.Data[offset+10 : offset+10+w]
+		x := make([]Coord, w)
+		for j, value := range xx {
+			x[j].Coord = j
+			x[j].Signal = value
+		}
+		sort.Slice(x, func(i, j int) bool {
+			return x[i].Signal > x[j].Signal
+		})
+		yy := w1.Data[offset+10+w : offset+10+w+h]
+		y := make([]Coord, h)
+		for j, value := range yy {
+			y[j].Coord = j
+			y[j].Signal = value
+		}
+		sort.Slice(y, func(i, j int) bool {
+			return y[i].Signal > y[j].Signal
+		})
+		result := Result{
+			Color:       byte(color),
+			Signal:      maxColor,
+			Probability: Probability(cc, color),
+			IX:          0,
+			IY:          0,
+			X:           x,
+			Y:           y,
+		}
 
-			var apply func(result Result) bool
-			apply = func(result Result) bool {
-				x, y := result.X[result.IX].Coord, result.Y[result.IY].Coord
-				if result.Signal > grid[y][x].Signal {
-					if grid[y][x].Signal != 0 {
-						for {
-							sx := false
-							if grid[y][x].IX < w-1 {
-								sx = true
-								grid[y][x].IX++
-								if apply(grid[y][x]) {
-									break
-								}
-							}
-							sy := false
-							if grid[y][x].IY < h-1 {
-								sy = true
-								grid[y][x].IY++
-								if apply(grid[y][x]) {
-									break
-								}
+		var apply func(result Result) bool
+		apply = func(result Result) bool {
+			x, y := result.X[result.IX].Coord, result.Y[result.IY].Coord
+			if result.Signal > grid[y][x].Signal {
+				if grid[y][x].Signal != 0 {
+					for {
+						sx := false
+						if grid[y][x].IX < w-1 {
+							sx = true
+							grid[y][x].IX++
+							if apply(grid[y][x]) {
+								break
 							}
-							if sx && sy {
+						}
+						sy := false
+						if grid[y][x].IY < h-1 {
+							sy = true
+							grid[y][x].IY++
+							if apply(grid[y][x]) {
 								break
 							}
 						}
+						// Neither axis can advance once both coordinate lists are exhausted
+						if sx == sy {
+							break
+						}
 					}
-					grid[y][x] = result
-					return true
 				}
-				return false
+				grid[y][x] = result
+				return true
 			}
-			for {
-				sx := false
-				if result.IX < w-1 {
-					sx = true
-					result.IX++
-					if apply(result) {
-						break
-					}
-				}
-				sy := false
-				if result.IY < h-1 {
-					sy = true
-					result.IY++
-					if apply(result) {
-						break
-					}
+			return false
+		}
+		for {
+			sx := false
+			if result.IX < w-1 {
+				sx = true
+				result.IX++
+				if apply(result) {
+					break
 				}
-				if sx && sy {
+			}
+			sy := false
+			if result.IY < h-1 {
+				sy = true
+				result.IY++
+				if apply(result) {
 					break
 				}
 			}
+			if sx == sy {
+				break
+			}
 		}
-		index := 0
-		sum, total := 0.0, 0.0
+	}
+	colors, probabilities := make([][]byte, h), make([][]float32, h)
+	for j, v := range grid {
+		colors[j], probabilities[j] = make([]byte, w), make([]float32, w)
+		for i, value := range v {
+			colors[j][i], probabilities[j][i] = value.Color, value.Probability
+		}
+	}
+	return colors, probabilities
+}
+
+// SA is self attention mode
+func SA() {
+	sets := Load()
+	opt := GetTrainingData(sets, 0, 0)
+	w, h := opt[0].Output.Output.W, opt[0].Output.Output.H
+	TrainSA(1, opt, func(i int, sample matrix.Sample) {
+		grid, _ := DecodeSA(sample, w, h)
 		for _, v := range grid {
 			for _, value := range v {
-				color := opt[0].Output.Output.I[index].C
-				if color == value.Color {
-					sum++
-					fmt.Printf("* ")
-				} else {
-					fmt.Printf("%d ", value.Color)
-				}
-				index++
-				total++
+				fmt.Printf("%d ", value)
 			}
 			fmt.Println()
 		}
-		fmt.Println("accuracy", sum/total)
-		if cost < 0 {
-			cost = 0
-			break
-		}
-		if cost < 1e-9 {
-			break
-		}
-	}
+		accuracy, exact := sets[0].Test[0].Output.Score(grid)
+		fmt.Println("accuracy", accuracy, "exact", exact)
+	})
 }
@@ -0,0 +1,119 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pointlander/frozenstar/kmeans"
+	"github.com/pointlander/matrix"
+)
+
+// Entry is the embedding of a train pair of a task
+type Entry struct {
+	Task      string
+	Pair      int
+	Embedding []float32
+}
+
+// Index is an embedding index of the train pairs of the tasks
+type Index []Entry
+
+// Neighbor is a task near another task
+type Neighbor struct {
+	Task     string
+	Distance float64
+}
+
+// NewIndex embeds the train pairs of all of the sets with the encoder
+func NewIndex(sets []Set, params []matrix.Matrix) Index {
+	index := make(Index, 0, 8)
+	for s, set := range sets {
+		for i, pair := range NewPairs(sets[s : s+1]) {
+			index = append(index, Entry{
+				Task:      set.Name,
+				Pair:      i,
+				Embedding: Encode(params, pair),
+			})
+		}
+	}
+	return index
+}
+
+// Nearest returns the n tasks nearest to task, where the distance of a task is the mean
+// distance from each train pair of task to the nearest train pair of the other task
+func (x Index) Nearest(task string, n int) []Neighbor {
+	query := make([]Entry, 0, 8)
+	for _, entry := range x {
+		if entry.Task == task {
+			query = append(query, entry)
+		}
+	}
+	if len(query) == 0 {
+		return nil
+	}
+	nearest := make(map[string][]float64)
+	for _, q := range query {
+		best := make(map[string]float64)
+		for _, entry := range x {
+			if entry.Task == task {
+				continue
+			}
+			distance, err := kmeans.Euclidean(q.Embedding, entry.Embedding)
+			if err != nil {
+				panic(err)
+			}
+			if d, ok := best[entry.Task]; !ok || distance < d {
+				best[entry.Task] = distance
+			}
+		}
+		for t, distance := range best {
+			nearest[t] = append(nearest[t], distance)
+		}
+	}
+	neighbors := make([]Neighbor, 0, len(nearest))
+	for t, distances := range nearest {
+		sum := 0.0
+		for _, distance := range distances {
+			sum += distance
+		}
+		neighbors = append(neighbors, Neighbor{
+			Task:     t,
+			Distance: sum / float64(len(distances)),
+		})
+	}
+	sort.Slice(neighbors, func(i, j int) bool {
+		if neighbors[i].Distance == neighbors[j].Distance {
+			return neighbors[i].Task < neighbors[j].Task
+		}
+		return neighbors[i].Distance < neighbors[j].Distance
+	})
+	if len(neighbors) > n {
+		neighbors = neighbors[:n]
+	}
+	return neighbors
+}
+
+// Similar finds the tasks most similar to a task by the embeddings of the clustering encoder
+func Similar(task string) {
+	sets := Load()
+	found := false
+	for _, set := range sets {
+		if set.Name == task {
+			found = true
+			break
+		}
+	}
+	if !found {
+		panic(fmt.Errorf("task %s not found", task))
+	}
+	size := min(Size, len(sets))
+	sample := TrainCluster(NewPairs(sets[:size]), size, nil)
+	index := NewIndex(sets, EncoderParams(sample))
+	for i, neighbor := range index.Nearest(task, *FlagNeighbors) {
+		fmt.Printf("%3d %s %f\n", i, neighbor.Task, neighbor.Distance)
+	}
+}
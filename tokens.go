@@ -0,0 +1,258 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/pointlander/frozenstar/autodiff"
+	"github.com/pointlander/matrix"
+)
+
+// ObjectOpt is an optimization over object tokens
+type ObjectOpt struct {
+	Opt        matrix.Matrix
+	Input      []Object
+	Output     []Object
+	Test       []Object
+	Background uint8
+	Targets    int
+	W          int
+	H          int
+}
+
+// TargetOffset is the target offset
+func (o ObjectOpt) TargetOffset() int {
+	return len(o.Input) + len(o.Output) + len(o.Test)
+}
+
+// TargetSize is the size of the target
+func (o ObjectOpt) TargetSize() int {
+	return o.Targets
+}
+
+// Tokens returns the rows of object tokens of the optimization
+func (o ObjectOpt) Tokens() Tokens {
+	return Tokens{
+		Opt:     o.Opt,
+		Output:  len(o.Input),
+		Outputs: len(o.Output),
+		Offset:  o.TargetOffset(),
+		Size:    o.TargetSize(),
+	}
+}
+
+// ObjectTokens is the encoding of objects into tokens of a color, a bounding box, features and the output flag
+var ObjectTokens = Encoding{
+	Width: ObjectInput,
+	Fill:  Fill,
+	Soft:  SoftObject,
+}
+
+// SoftObject is the softmax of the color and the bounding box of rows of parameters,
+// passing through the features and setting the output flag
+func SoftObject(t *autodiff.Tape, params *autodiff.Value) *autodiff.Value {
+	features, flag := matrix.NewZeroMatrix(ObjectInput, 1), matrix.NewZeroMatrix(ObjectInput, 1)
+	for i := 10 + 4*30; i < 10+4*30+4; i++ {
+		features.Data[i] = 1
+	}
+	flag.Data[10+4*30+4] = 1
+	soft := t.Softmax(params, 10, 30, 30, 30, 30)
+	return t.Add(t.Add(soft, t.H(params, t.Var(features))), t.Var(flag))
+}
+
+// Detect extracts the objects of an image for tokenization
+func Detect(image Image) []Object {
+	return image.Objects(image.Background(), true, false)
+}
+
+// Token encodes the object into an object token
+func (o Object) Token(token []float32, output bool) {
+	token[o.Color] = 1
+	token[10+o.X] = 1
+	token[10+30+o.Y] = 1
+	token[10+2*30+o.W-1] = 1
+	token[10+3*30+o.H-1] = 1
+	features := token[10+4*30:]
+	features[0] = float32(o.Size()) / (30 * 30)
+	features[1] = float32(o.Size()) / float32(o.W*o.H)
+	horizontal, vertical := float32(1), float32(1)
+	for j, row := range o.Mask {
+		for i, value := range row {
+			if value != row[o.W-i-1] {
+				horizontal = 0
+			}
+			if value != o.Mask[o.H-j-1][i] {
+				vertical = 0
+			}
+		}
+	}
+	features[2], features[3] = horizontal, vertical
+	if output {
+		features[4] = 1
+	}
+}
+
+// NewObjectOpts creates the optimizations for predicting the objects of the output of test from train
+func NewObjectOpts(train []Pair, test Pair) (opt []ObjectOpt) {
+	opt = make([]ObjectOpt, len(train))
+	testObjects := Detect(test.Input)
+	for i, pair := range train {
+		opt[i].Input = Detect(pair.Input)
+		opt[i].Output = Detect(pair.Output)
+		opt[i].Test = testObjects
+		opt[i].Targets = len(testObjects)
+		if opt[i].Targets == 0 {
+			opt[i].Targets = 1
+		}
+		opt[i].Background = test.Input.Background()
+		opt[i].W, opt[i].H = test.Output.W, test.Output.H
+		opt[i].Opt = matrix.NewZeroMatrix(ObjectInput, opt[i].TargetOffset()+opt[i].TargetSize())
+		index := 0
+		for _, object := range opt[i].Input {
+			object.Token(opt[i].Opt.Data[index:index+ObjectInput], false)
+			index += ObjectInput
+		}
+		for _, object := range opt[i].Output {
+			object.Token(opt[i].Opt.Data[index:index+ObjectInput], true)
+			index += ObjectInput
+		}
+		for _, object := range opt[i].Test {
+			object.Token(opt[i].Opt.Data[index:index+ObjectInput], false)
+			index += ObjectInput
+		}
+	}
+	return opt
+}
+
+// GetObjectTrainingData gets the object token training data
+func GetObjectTrainingData(sets []Set, s, t int) []ObjectOpt {
+	train := make([]Pair, 0, 8)
+	set := sets[s]
+	for _, t := range set.Train {
+		train = append(train, NewPair(s, t))
+	}
+	test := NewInput(s, set.Test[t].Input, 0, 0)
+	test.Output.W, test.Output.H = PredictSize(train, test.Input)
+	return NewObjectOpts(train, test)
+}
+
+// argmax returns the index of the largest value
+func argmax(values []float32) int {
+	index := 0
+	for i, value := range values {
+		if value > values[index] {
+			index = i
+		}
+	}
+	return index
+}
+
+// Fill fills a target object token from a row of parameters
+func Fill(token, params []float32) {
+	token[argmax(params[:10])] = 1
+	for i := 0; i < 4; i++ {
+		offset := 10 + i*30
+		token[offset+argmax(params[offset:offset+30])] = 1
+	}
+	copy(token[10+4*30:10+4*30+4], params[10+4*30:10+4*30+4])
+	token[10+4*30+4] = 1
+}
+
+// Paint paints the objects decoded from rows of object tokens into a w by h grid,
+// borrowing the masks of shapes with the same bounding box size
+func Paint(tokens matrix.Matrix, w, h int, background uint8, shapes []Object) [][]byte {
+	grid := make([][]byte, h)
+	for j := range grid {
+		grid[j] = make([]byte, w)
+		for i := range grid[j] {
+			grid[j][i] = background
+		}
+	}
+	for row := 0; row < tokens.Rows; row++ {
+		token := tokens.Data[row*tokens.Cols : (row+1)*tokens.Cols]
+		color := byte(argmax(token[:10]))
+		x, y := argmax(token[10:10+30]), argmax(token[10+30:10+2*30])
+		ww, hh := argmax(token[10+2*30:10+3*30])+1, argmax(token[10+3*30:10+4*30])+1
+		var mask [][]bool
+		for _, shape := range shapes {
+			if shape.W == ww && shape.H == hh {
+				mask = shape.Mask
+				break
+			}
+		}
+		for j := 0; j < hh; j++ {
+			for i := 0; i < ww; i++ {
+				if x+i >= w || y+j >= h {
+					continue
+				}
+				if mask != nil && !mask[j][i] {
+					continue
+				}
+				grid[y+j][x+i] = color
+			}
+		}
+	}
+	return grid
+}
+
+// objectTokens returns the rows of object tokens of the optimizations
+func objectTokens(opts []ObjectOpt) []Tokens {
+	tokens := make([]Tokens, len(opts))
+	for i := range opts {
+		tokens[i] = opts[i].Tokens()
+	}
+	return tokens
+}
+
+// SAObjects is self attention mode over object tokens
+func SAObjects() {
+	sets := Load()
+	source := GetObjectTrainingData(sets, 0, 0)
+	fmt.Println("tokens", source[0].Opt.Rows, "targets", source[0].TargetSize())
+	TrainSATokens(1, ObjectTokens, objectTokens(source), func(i int, sample matrix.Sample) {
+		x1 := sample.Vars[0][0].Sample()
+		y1 := sample.Vars[0][1].Sample()
+		z1 := sample.Vars[0][2].Sample()
+		w1 := x1.Add(y1.H(z1))
+		grid := Paint(w1, source[0].W, source[0].H, source[0].Background, source[0].Test)
+		for _, v := range grid {
+			for _, value := range v {
+				fmt.Printf("%d ", value)
+			}
+			fmt.Println()
+		}
+		accuracy, exact := sets[0].Test[0].Output.Score(grid)
+		fmt.Println("accuracy", accuracy, "exact", exact)
+	})
+}
+
+// ACObjects is autocoder mode over object tokens
+func ACObjects() {
+	sets := Load()
+	sources := make([][]ObjectOpt, *FlagSets)
+	opts := make([][]Tokens, *FlagSets)
+	for i := range opts {
+		sources[i] = GetObjectTrainingData(sets, i, 0)
+		opts[i] = objectTokens(sources[i])
+	}
+	TrainACTokens(1, ObjectTokens, opts, func(i int, sample matrix.Sample) {
+		for j, source := range sources {
+			x1 := sample.Vars[5+j][0].Sample()
+			y1 := sample.Vars[5+j][1].Sample()
+			z1 := sample.Vars[5+j][2].Sample()
+			w1 := x1.Add(y1.H(z1))
+			grid := Paint(w1, source[0].W, source[0].H, source[0].Background, source[0].Test)
+			for _, v := range grid {
+				for _, value := range v {
+					fmt.Printf("%d ", value)
+				}
+				fmt.Println()
+			}
+			accuracy, exact := sets[j].Test[0].Output.Score(grid)
+			fmt.Println("accuracy", accuracy, "exact", exact)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pointlander/frozenstar/autodiff"
+	"github.com/pointlander/matrix"
+)
+
+// tokenGrid has a plus, a bar and an L shape on a background of 0
+var tokenGrid = [][]byte{
+	{0, 3, 0, 0, 0, 0},
+	{3, 3, 3, 0, 5, 5},
+	{0, 3, 0, 0, 0, 0},
+	{0, 0, 0, 7, 0, 0},
+	{0, 0, 0, 7, 7, 0},
+}
+
+func TestToken(t *testing.T) {
+	objects := Detect(NewImage(tokenGrid))
+	if len(objects) != 3 {
+		t.Fatalf("%d objects", len(objects))
+	}
+	tests := []struct {
+		object                 Object
+		output                 bool
+		color, x, y, w, h      int
+		fill, horizontal, vert float32
+	}{
+		{objects[0], false, 3, 0, 0, 3, 3, 5. / 9, 1, 1},
+		{objects[1], true, 5, 4, 1, 2, 1, 1, 1, 1},
+		{objects[2], false, 7, 3, 3, 2, 2, 3. / 4, 0, 0},
+	}
+	for i, test := range tests {
+		token := make([]float32, ObjectInput)
+		test.object.Token(token, test.output)
+		expected := make([]float32, ObjectInput)
+		expected[test.color] = 1
+		expected[10+test.x] = 1
+		expected[10+30+test.y] = 1
+		expected[10+2*30+test.w-1] = 1
+		expected[10+3*30+test.h-1] = 1
+		features := expected[10+4*30:]
+		features[0] = float32(test.object.Size()) / (30 * 30)
+		features[1] = test.fill
+		features[2], features[3] = test.horizontal, test.vert
+		if test.output {
+			features[4] = 1
+		}
+		if !reflect.DeepEqual(token, expected) {
+			t.Errorf("object %d token %v, expected %v", i, token, expected)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	params := make([]float32, ObjectInput)
+	for i := range params {
+		params[i] = -float32(i%7) / 10
+	}
+	params[4] = 2
+	params[10+12] = 1
+	params[10+30+29] = 3
+	params[10+2*30] = .5
+	params[10+3*30+5] = .25
+	copy(params[10+4*30:], []float32{.1, .2, .3, .4, -1})
+	token := make([]float32, ObjectInput)
+	Fill(token, params)
+	expected := make([]float32, ObjectInput)
+	expected[4] = 1
+	expected[10+12] = 1
+	expected[10+30+29] = 1
+	expected[10+2*30] = 1
+	expected[10+3*30+5] = 1
+	copy(expected[10+4*30:], []float32{.1, .2, .3, .4, 1})
+	if !reflect.DeepEqual(token, expected) {
+		t.Errorf("token %v, expected %v", token, expected)
+	}
+}
+
+// testTokens returns the rows of object tokens of the test input of opt
+func testTokens(opt ObjectOpt) matrix.Matrix {
+	offset := len(opt.Input) + len(opt.Output)
+	rows := opt.Opt.Data[offset*ObjectInput : (offset+len(opt.Test))*ObjectInput]
+	return matrix.NewMatrix(ObjectInput, len(opt.Test), rows...)
+}
+
+func TestPaintObjectOpts(t *testing.T) {
+	train := []Pair{NewPair(0, Example{Input: tokenGrid, Output: tokenGrid})}
+	test := NewInput(0, tokenGrid, len(tokenGrid[0]), len(tokenGrid))
+	opts := NewObjectOpts(train, test)
+	if len(opts) != 1 {
+		t.Fatalf("%d optimizations", len(opts))
+	}
+	opt := opts[0]
+	if opt.Opt.Rows != 3*3+3 || opt.TargetOffset() != 9 || opt.TargetSize() != 3 {
+		t.Fatalf("%d rows with %d targets at %d", opt.Opt.Rows, opt.TargetSize(), opt.TargetOffset())
+	}
+	tokens := testTokens(opt)
+	grid := Paint(tokens, opt.W, opt.H, opt.Background, opt.Test)
+	if !reflect.DeepEqual(grid, tokenGrid) {
+		t.Errorf("painted %v", grid)
+	}
+
+	// Filling the target rows from the test tokens paints the same grid
+	target := matrix.NewZeroMatrix(ObjectInput, tokens.Rows)
+	for row := 0; row < tokens.Rows; row++ {
+		Fill(target.Data[row*ObjectInput:(row+1)*ObjectInput], tokens.Data[row*ObjectInput:(row+1)*ObjectInput])
+	}
+	grid = Paint(target, opt.W, opt.H, opt.Background, opt.Test)
+	if !reflect.DeepEqual(grid, tokenGrid) {
+		t.Errorf("painted %v from filled tokens", grid)
+	}
+}
+
+func TestObjectOptTokens(t *testing.T) {
+	train := []Pair{NewPair(0, Example{Input: tokenGrid, Output: [][]byte{{2, 0}, {0, 4}}})}
+	opts := NewObjectOpts(train, NewInput(0, tokenGrid, 2, 2))
+	tokens := opts[0].Tokens()
+	if tokens.Output != 3 || tokens.Outputs != 2 || tokens.Offset != 8 || tokens.Size != 3 {
+		t.Errorf("%d outputs at %d and %d targets at %d", tokens.Outputs, tokens.Output, tokens.Size, tokens.Offset)
+	}
+}
+
+func TestSoftObject(t *testing.T) {
+	params := make([]float32, 2*ObjectInput)
+	for i := range params {
+		params[i] = float32((i*37)%11) / 5
+	}
+	tape := autodiff.NewTape()
+	soft := SoftObject(tape, tape.Var(matrix.NewMatrix(ObjectInput, 2, params...)))
+	for row := 0; row < 2; row++ {
+		p := params[row*ObjectInput : (row+1)*ObjectInput]
+		s := soft.X.Data[row*ObjectInput : (row+1)*ObjectInput]
+		token := make([]float32, ObjectInput)
+		Fill(token, p)
+		for i := 0; i < 5; i++ {
+			begin, end := 0, 10
+			if i > 0 {
+				begin, end = 10+(i-1)*30, 10+i*30
+			}
+			sum := float32(0)
+			for _, value := range s[begin:end] {
+				sum += value
+			}
+			if sum < .999 || sum > 1.001 {
+				t.Errorf("row %d group %d sums to %f", row, i, sum)
+			}
+			if argmax(s[begin:end]) != argmax(token[begin:end]) {
+				t.Errorf("row %d group %d argmax %d, expected %d", row, i, argmax(s[begin:end]), argmax(token[begin:end]))
+			}
+		}
+		if !reflect.DeepEqual(s[10+4*30:], token[10+4*30:]) {
+			t.Errorf("row %d features %v, expected %v", row, s[10+4*30:], token[10+4*30:])
+		}
+	}
+}
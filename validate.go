@@ -0,0 +1,146 @@
+// Copyright 2024 The FrozenStar Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Candidate is a candidate solution for a test input
+type Candidate struct {
+	Solver     string
+	Seed       uint32
+	Rate       float64
+	Cost       float64
+	Grid       [][]byte
+	Confidence [][]float32
+	Score      float64
+}
+
+// Exact returns true if the grid matches the image exactly
+func Exact(grid [][]byte, image Image) bool {
+	if len(grid) != image.H {
+		return false
+	}
+	for _, row := range grid {
+		if len(row) != image.W {
+			return false
+		}
+	}
+	for _, p := range image.I {
+		if grid[p.Y][p.X] != p.C {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate computes the leave one out exact match rate of a predictor with seed on set s
+func Validate(sets []Set, s int, predictor Predictor, seed uint32) float64 {
+	train := sets[s].Train
+	if len(train) < 2 {
+		return 0
+	}
+	exact := 0
+	for h := range train {
+		fold := Set{
+			Test:  []Test{{Input: train[h].Input}},
+			Train: make([]Example, 0, len(train)-1),
+		}
+		fold.Train = append(fold.Train, train[:h]...)
+		fold.Train = append(fold.Train, train[h+1:]...)
+		prediction := predictor(fold, seed)[0]
+		match := Exact(prediction.Grid, NewPair(s, train[h]).Output)
+		if match {
+			exact++
+		}
+		fmt.Println("fold", h, match)
+	}
+	return float64(exact) / float64(len(train))
+}
+
+// Attempts ranks the candidates by leave one out exact match rate and then cost and
+// returns up to two distinct grids as the submission attempts
+func Attempts(candidates []Candidate) []Candidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Rate == candidates[j].Rate {
+			return candidates[i].Cost < candidates[j].Cost
+		}
+		return candidates[i].Rate > candidates[j].Rate
+	})
+	attempts := make([]Candidate, 0, 2)
+	for _, candidate := range candidates {
+		duplicate := false
+		for _, attempt := range attempts {
+			if Equal(attempt.Grid, candidate.Grid) {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		attempts = append(attempts, candidate)
+		if len(attempts) == 2 {
+			break
+		}
+	}
+	return attempts
+}
+
+// Equal returns true if two grids are the same
+func Equal(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for j := range a {
+		if len(a[j]) != len(b[j]) {
+			return false
+		}
+		for i := range a[j] {
+			if a[j][i] != b[j][i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Validation is the leave one out validation mode
+func Validation() {
+	sets := Load()
+	solved, total := 0, 0
+	for s := 0; s < *FlagSets; s++ {
+		rates := make([]float64, *FlagCandidates)
+		for i := range rates {
+			rates[i] = Validate(sets, s, Predict, uint32(i+1))
+		}
+		for t := range sets[s].Test {
+			candidates := make([]Candidate, *FlagCandidates)
+			for i := range candidates {
+				seed := uint32(i + 1)
+				candidates[i].Seed = seed
+				candidates[i].Rate = rates[i]
+				prediction := Predict(Set{Test: sets[s].Test[t : t+1], Train: sets[s].Train}, seed)[0]
+				candidates[i].Cost = prediction.Cost
+				candidates[i].Grid, candidates[i].Confidence = prediction.Grid, prediction.Confidence
+				fmt.Println("set", s, "test", t, "seed", seed, "loo", candidates[i].Rate, "cost", candidates[i].Cost)
+			}
+			attempts := Attempts(candidates)
+			correct := false
+			for i, attempt := range attempts {
+				_, exact := sets[s].Test[t].Output.Score(attempt.Grid)
+				fmt.Println("attempt", i, "seed", attempt.Seed, "loo", attempt.Rate, "exact", exact)
+				correct = correct || exact
+			}
+			if correct {
+				solved++
+			}
+			total++
+		}
+	}
+	fmt.Println("solved", solved, "of", total)
+}